@@ -1,20 +1,38 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 	"k8s.io/apiserver/pkg/util/logs"
 
 	"github.com/dastanng/gitbot/pkg/bot"
+	"github.com/dastanng/gitbot/pkg/bot/audit"
+	"github.com/dastanng/gitbot/pkg/bot/scheduler"
 )
 
 var (
-	opts    bot.InitOptions
-	rootCmd = &cobra.Command{
+	opts      bot.InitOptions
+	auditFile string
+	auditRepo string
+	auditQ    audit.Query
+	syncOpts  bot.LabelSyncOptions
+	syncApply bool
+	notesOpts bot.ReleaseNotesOptions
+	adminURL  string
+	adminAuth string
+	rootCmd   = &cobra.Command{
 		Use:          "bot",
 		Short:        "github bot",
 		Long:         "github bot watches github events and reacts respectively.",
@@ -29,13 +47,117 @@ var (
 			flag.CommandLine.Parse([]string{})
 
 			bot := new(bot.Bot)
-			bot.Initialize(opts)
+			if err := bot.Initialize(opts); err != nil {
+				return err
+			}
 
 			stopCh := setupSignalHandler()
 			bot.Run(stopCh)
 			return nil
 		},
 	}
+	auditCmd = &cobra.Command{
+		Use:   "audit",
+		Short: "Query the audit log of bot actions",
+		RunE: func(*cobra.Command, []string) error {
+			if len(auditRepo) > 0 {
+				parts := strings.SplitN(auditRepo, "/", 2)
+				if len(parts) != 2 {
+					return fmt.Errorf("--repo should be owner/repo")
+				}
+				auditQ.Owner, auditQ.Repo = parts[0], parts[1]
+			}
+			records, err := audit.Read(auditFile, auditQ)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "TIME\tUSER\tREPO\tNUMBER\tCOMMAND\tACTION\tBEFORE\tAFTER\tCOMMENT")
+			for _, r := range records {
+				fmt.Fprintf(w, "%s\t%s\t%s/%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+					r.Time.Format(time.RFC3339), r.User, r.Owner, r.Repo, r.Number,
+					r.Command, r.Action, strings.Join(r.Before, ","), strings.Join(r.After, ","),
+					r.CommentURL,
+				)
+			}
+			return w.Flush()
+		},
+	}
+	labelsCmd = &cobra.Command{
+		Use:   "labels",
+		Short: "Manage repo labels",
+	}
+	jobsCmd = &cobra.Command{
+		Use:   "jobs",
+		Short: "Inspect and trigger periodic jobs of a running webhook service",
+	}
+	jobsListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Show the last run of every job",
+		RunE: func(*cobra.Command, []string) error {
+			var jobs []scheduler.Status
+			if err := adminRequest(http.MethodGet, "/api/jobs", &jobs); err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tINTERVAL\tRUNNING\tRUNS\tLAST START\tLAST END\tLAST ERROR")
+			for _, j := range jobs {
+				fmt.Fprintf(w, "%s\t%s\t%t\t%d\t%s\t%s\t%s\n",
+					j.Name, j.Interval, j.Running, j.Runs,
+					formatTime(j.LastStart), formatTime(j.LastEnd), j.LastError,
+				)
+			}
+			return w.Flush()
+		},
+	}
+	jobsRunCmd = &cobra.Command{
+		Use:   "run NAME",
+		Short: "Start a job now, unless it's running",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if err := adminRequest(http.MethodPost, "/api/jobs/run?name="+url.QueryEscape(args[0]), nil); err != nil {
+				return err
+			}
+			fmt.Printf("job %s started\n", args[0])
+			return nil
+		},
+	}
+	labelsSyncCmd = &cobra.Command{
+		Use:   "sync",
+		Short: "Make repo labels match a label file",
+		Long: "Make repo labels match a label file (or preset labels): create missing labels, update colors and descriptions,\n" +
+			"rename labels listed in 'previously' and optionally delete unknown labels.\n" +
+			"The plan is printed, and only applied with --apply.",
+		RunE: func(*cobra.Command, []string) error {
+			if len(syncOpts.Orgs) == 0 && len(syncOpts.Repos) == 0 {
+				return fmt.Errorf("at least one --org or --repo is required")
+			}
+			syncOpts.DryRun = !syncApply
+
+			// only an applied plan is audited
+			bot := new(bot.Bot)
+			if err := bot.InitializeClient(opts, syncApply); err != nil {
+				return err
+			}
+			return bot.SyncLabels(context.Background(), syncOpts, os.Stdout)
+		},
+	}
+	releaseNotesCmd = &cobra.Command{
+		Use:   "release-notes",
+		Short: "Render release notes of the pullrequests merged between two tags",
+		Long: "Render markdown release notes of the pullrequests merged between two tags, grouped by kind label.\n" +
+			"Pullrequests are found by the commits reachable from --to but not from --from, notes are taken\n" +
+			"from the release-note block of descriptions, falling back to titles.",
+		RunE: func(*cobra.Command, []string) error {
+			bot := new(bot.Bot)
+			if err := bot.InitializeClient(opts, false); err != nil {
+				return err
+			}
+			return bot.ReleaseNotes(context.Background(), notesOpts, os.Stdout)
+		},
+	}
 )
 
 func init() {
@@ -51,7 +173,74 @@ func init() {
 		webhookCmd.PersistentFlags(),
 		"secret",
 	)
+	webhookCmd.PersistentFlags().StringVar(&opts.ConfigFile, "config", "",
+		"Path to the bot config file (yaml)")
+	webhookCmd.PersistentFlags().StringVar(&opts.LogFormat, "log-format", bot.LogFormatText,
+		"Log format, one of text or json")
+	webhookCmd.PersistentFlags().StringVar(&opts.PresetsFile, "presets", "",
+		"Path to the global preset labels file (json or yaml), overrides config")
+	webhookCmd.PersistentFlags().StringVar(&opts.AdminToken, "admin-token", "",
+		"A bearer token allowed to use the whole admin api, e.g. /api/audit")
 	rootCmd.AddCommand(webhookCmd)
+
+	auditCmd.Flags().StringVar(&auditFile, "file", "audit.jsonl",
+		"Path to the audit log")
+	auditCmd.Flags().StringVar(&auditRepo, "repo", "",
+		"Only show actions on repo (owner/repo)")
+	auditCmd.Flags().IntVar(&auditQ.Number, "number", 0,
+		"Only show actions on issue (or pullrequest) number")
+	auditCmd.Flags().StringVar(&auditQ.User, "user", "",
+		"Only show actions triggered by user")
+	auditCmd.Flags().IntVar(&auditQ.Limit, "limit", 0,
+		"Only show the latest actions")
+	rootCmd.AddCommand(auditCmd)
+
+	labelsSyncCmd.Flags().StringVar(&opts.Token, "token", "",
+		"A token that can be used to access the GitHub API")
+	cobra.MarkFlagRequired(
+		labelsSyncCmd.Flags(),
+		"token",
+	)
+	labelsSyncCmd.Flags().StringVar(&opts.ConfigFile, "config", "",
+		"Path to the bot config file (yaml)")
+	labelsSyncCmd.Flags().StringVar(&opts.PresetsFile, "presets", "",
+		"Path to the global preset labels file (json or yaml), overrides config")
+	labelsSyncCmd.Flags().StringVar(&syncOpts.File, "file", "",
+		"Path to the label file (json or yaml), preset labels are used if empty")
+	labelsSyncCmd.Flags().StringSliceVar(&syncOpts.Orgs, "org", nil,
+		"Sync every repo of the org")
+	labelsSyncCmd.Flags().StringSliceVar(&syncOpts.Repos, "repo", nil,
+		"Sync the repo (owner/repo)")
+	labelsSyncCmd.Flags().BoolVar(&syncOpts.Delete, "delete", false,
+		"Delete labels which are not in the label file")
+	labelsSyncCmd.Flags().BoolVar(&syncApply, "apply", false,
+		"Apply the plan, otherwise it's only printed")
+	labelsSyncCmd.Flags().StringVar(&syncOpts.User, "user", os.Getenv("USER"),
+		"Who applies the plan, written to the audit log")
+	labelsCmd.AddCommand(labelsSyncCmd)
+	rootCmd.AddCommand(labelsCmd)
+
+	releaseNotesCmd.Flags().StringVar(&opts.Token, "token", "",
+		"A token that can be used to access the GitHub API")
+	releaseNotesCmd.Flags().StringVar(&opts.ConfigFile, "config", "",
+		"Path to the bot config file (yaml)")
+	releaseNotesCmd.Flags().StringVar(&notesOpts.Repo, "repo", "",
+		"The repo (owner/repo)")
+	releaseNotesCmd.Flags().StringVar(&notesOpts.From, "from", "",
+		"The tag of the previous release")
+	releaseNotesCmd.Flags().StringVar(&notesOpts.To, "to", "",
+		"The tag of the release")
+	for _, name := range []string{"token", "repo", "from", "to"} {
+		cobra.MarkFlagRequired(releaseNotesCmd.Flags(), name)
+	}
+	rootCmd.AddCommand(releaseNotesCmd)
+
+	jobsCmd.PersistentFlags().StringVar(&adminURL, "admin-url", "http://localhost:11112",
+		"Address of the admin api of the webhook service")
+	jobsCmd.PersistentFlags().StringVar(&adminAuth, "admin-token", "",
+		"A bearer token of the admin api, with scope jobs:read or jobs:run")
+	jobsCmd.AddCommand(jobsListCmd, jobsRunCmd)
+	rootCmd.AddCommand(jobsCmd)
 }
 
 func main() {
@@ -60,6 +249,43 @@ func main() {
 	}
 }
 
+// adminRequest calls the admin api, decoding the response into v if not nil
+func adminRequest(method, path string, v interface{}) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(adminURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	if len(adminAuth) > 0 {
+		req.Header.Set("Authorization", "Bearer "+adminAuth)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&e) != nil || len(e.Error) == 0 {
+			e.Error = resp.Status
+		}
+		return fmt.Errorf("%s %s: %s", method, path, e.Error)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
 // setupSignalHandler registered for SIGTERM and SIGINT. A stop channel is returned
 // which is closed on one of these signals. If a second signal is caught, the program
 // is terminated with exit code 1.
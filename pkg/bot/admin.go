@@ -0,0 +1,323 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dastanng/gitbot/pkg/bot/audit"
+	"github.com/dastanng/gitbot/pkg/bot/config"
+)
+
+// admin api scopes
+const (
+	scopeAll        = "*"
+	scopeLabelWrite = "labels:write"
+	scopeAuditRead  = "audit:read"
+	scopeJobsRead   = "jobs:read"
+	scopeJobsRun    = "jobs:run"
+)
+
+var adminScopes = []string{scopeLabelWrite, scopeAuditRead, scopeJobsRead, scopeJobsRun}
+
+// principal is an authenticated client of the admin api
+type principal struct {
+	name   string
+	token  string // empty for certificate clients
+	scopes []string
+}
+
+// allowed returns whether p has scope on owner. An empty owner
+// requires the scope on every org.
+func (p *principal) allowed(scope, owner string) bool {
+	for _, s := range p.scopes {
+		if s == scopeAll {
+			return true
+		}
+		parts := strings.SplitN(s, ":", 3)
+		if parts[0]+":"+parts[1] != scope {
+			continue
+		}
+		if len(parts) == 2 || len(owner) > 0 && strings.EqualFold(parts[2], owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize returns a 403 error unless p has scope on owner
+func (p *principal) authorize(scope, owner string) error {
+	if p.allowed(scope, owner) {
+		return nil
+	}
+	if len(owner) == 0 {
+		return apiErrorf(http.StatusForbidden, "scope %s on all orgs is required", scope)
+	}
+	return apiErrorf(http.StatusForbidden, "scope %s on %s is required", scope, owner)
+}
+
+// apiError is an admin api error with its http status
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+func apiErrorf(status int, format string, args ...interface{}) *apiError {
+	return &apiError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// adminHandler serves an authenticated admin api request
+type adminHandler func(w http.ResponseWriter, r *http.Request, p *principal) error
+
+// statusWriter remembers the status of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// loadPrincipals builds admin api clients from config. The token of
+// --admin-token is allowed everything.
+func loadPrincipals(cfg config.AdminConfig, adminToken string) ([]*principal, error) {
+	var principals []*principal
+	if len(adminToken) > 0 {
+		principals = append(principals, &principal{name: "admin-token", token: adminToken, scopes: []string{scopeAll}})
+	}
+	for _, t := range cfg.Tokens {
+		if len(t.Name) == 0 || len(t.Token) == 0 {
+			return nil, fmt.Errorf("admin token: name and token are required")
+		}
+		if err := validateScopes(t.Scopes); err != nil {
+			return nil, fmt.Errorf("admin token %s: %v", t.Name, err)
+		}
+		principals = append(principals, &principal{name: t.Name, token: t.Token, scopes: t.Scopes})
+	}
+	for _, c := range cfg.Clients {
+		if len(c.CommonName) == 0 {
+			return nil, fmt.Errorf("admin client: common_name is required")
+		}
+		if err := validateScopes(c.Scopes); err != nil {
+			return nil, fmt.Errorf("admin client %s: %v", c.CommonName, err)
+		}
+		principals = append(principals, &principal{name: c.CommonName, scopes: c.Scopes})
+	}
+	return principals, nil
+}
+
+func validateScopes(scopes []string) error {
+	for _, s := range scopes {
+		if s == scopeAll {
+			continue
+		}
+		parts := strings.SplitN(s, ":", 3)
+		known := false
+		for _, a := range adminScopes {
+			if len(parts) >= 2 && parts[0]+":"+parts[1] == a {
+				known = true
+			}
+		}
+		if !known || len(parts) == 3 && len(parts[2]) == 0 {
+			return fmt.Errorf("invalid scope %q", s)
+		}
+	}
+	return nil
+}
+
+// authenticate returns the client of r by certificate or bearer token,
+// nil if it's unknown
+func (b *Bot) authenticate(r *http.Request) *principal {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, p := range b.principals {
+			if len(p.token) == 0 && p.name == cn {
+				return p
+			}
+		}
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil
+	}
+	token := []byte(strings.TrimPrefix(auth, "Bearer "))
+	var found *principal
+	for _, p := range b.principals {
+		// compare with every token to not leak which one matched
+		if len(p.token) > 0 && subtle.ConstantTimeCompare(token, []byte(p.token)) == 1 {
+			found = p
+		}
+	}
+	return found
+}
+
+// adminAPI authenticates and logs requests to h, errors are written as json
+func (b *Bot) adminAPI(method string, h adminHandler) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		w := &statusWriter{ResponseWriter: rw, status: http.StatusOK}
+		log := log.with("remote", r.RemoteAddr).with("method", r.Method).with("path", r.URL.Path)
+
+		p := b.authenticate(r)
+		var err error
+		switch {
+		case p == nil:
+			err = &apiError{http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized)}
+		case r.Method != method:
+			err = &apiError{http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed)}
+		default:
+			log = log.with("principal", p.name)
+			err = h(w, r, p)
+		}
+		if err != nil {
+			writeAPIError(w, err)
+		}
+
+		log = log.with("status", w.status).with("duration", time.Since(start).String())
+		if err != nil {
+			log.Infof("admin api request failed: %v", err)
+			return
+		}
+		log.Info("admin api request succeed")
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if e, ok := err.(*apiError); ok {
+		status = e.status
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// serveAdmin serves the admin api, it returns only on failure
+func (b *Bot) serveAdmin() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/labels", b.adminAPI(http.MethodPost, b.handleAddPresetLabels))
+	mux.HandleFunc("/api/audit", b.adminAPI(http.MethodGet, b.handleAudit))
+	mux.HandleFunc("/api/jobs", b.adminAPI(http.MethodGet, b.handleJobs))
+	mux.HandleFunc("/api/jobs/run", b.adminAPI(http.MethodPost, b.handleRunJob))
+
+	a := b.cfg.Admin
+	srv := &http.Server{Addr: a.Addr, Handler: mux}
+	if len(a.TLS.Cert) == 0 {
+		log.Infof("admin api started, listening on %s", a.Addr)
+		return srv.ListenAndServe()
+	}
+
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(a.TLS.ClientCA) > 0 {
+		pem, err := ioutil.ReadFile(a.TLS.ClientCA)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in %s", a.TLS.ClientCA)
+		}
+		// clients without certificate may still use bearer tokens
+		srv.TLSConfig.ClientCAs = pool
+		srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	log.Infof("admin api started, listening on %s (tls)", a.Addr)
+	return srv.ListenAndServeTLS(a.TLS.Cert, a.TLS.Key)
+}
+
+// handleAddPresetLabels adds preset labels to owner's repo,
+// or to every repo of owner if repo is not given
+func (b *Bot) handleAddPresetLabels(w http.ResponseWriter, r *http.Request, p *principal) error {
+	owner := r.URL.Query().Get("owner")
+	if len(owner) < 1 {
+		return apiErrorf(http.StatusBadRequest, "Url Param 'owner' is missing")
+	}
+	if err := p.authorize(scopeLabelWrite, owner); err != nil {
+		return err
+	}
+
+	repo := r.URL.Query().Get("repo")
+	if len(repo) < 1 {
+		// org-wide, repos are queued and the result of queueing each is
+		// reported
+		results, err := b.addOrgPresetLabels(r.Context(), owner, p.name)
+		if err != nil {
+			return apiErrorf(http.StatusBadGateway, "list repos of %s: %v", owner, err)
+		}
+		report := make(map[string]string, len(results))
+		for repo, err := range results {
+			report[repo] = "queued"
+			if err != nil {
+				report[repo] = err.Error()
+			}
+		}
+		writeJSON(w, http.StatusAccepted, report)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), b.cfg.Command.Timeout)
+	defer cancel()
+	c := &command{owner: owner, repo: repo, user: p.name, cmd: presetLabels}
+	if err := b.addPresetLabels(ctx, c); err != nil {
+		return apiErrorf(http.StatusBadGateway, "%v", err)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{owner + "/" + repo: "ok"})
+	return nil
+}
+
+// handleAudit queries the audit log, e.g. GET /api/audit?repo=owner/repo&number=1&user=dunjut
+func (b *Bot) handleAudit(w http.ResponseWriter, r *http.Request, p *principal) error {
+	var q audit.Query
+	params := r.URL.Query()
+	if repo := params.Get("repo"); len(repo) > 0 {
+		parts := strings.SplitN(repo, "/", 2)
+		if len(parts) != 2 {
+			return apiErrorf(http.StatusBadRequest, "Url Param 'repo' should be owner/repo")
+		}
+		q.Owner, q.Repo = parts[0], parts[1]
+	}
+	if err := p.authorize(scopeAuditRead, q.Owner); err != nil {
+		return err
+	}
+	if number := params.Get("number"); len(number) > 0 {
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return apiErrorf(http.StatusBadRequest, "Url Param 'number' is invalid")
+		}
+		q.Number = n
+	}
+	if limit := params.Get("limit"); len(limit) > 0 {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return apiErrorf(http.StatusBadRequest, "Url Param 'limit' is invalid")
+		}
+		q.Limit = n
+	}
+	q.User = params.Get("user")
+
+	records, err := b.audit.Query(q)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, records)
+	return nil
+}
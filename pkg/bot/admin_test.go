@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"testing"
+)
+
+func TestPrincipalAllowed(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		scope  string
+		owner  string
+		want   bool
+	}{
+		{[]string{scopeAll}, scopeJobsRun, "", true},
+		{[]string{scopeAll}, scopeLabelWrite, "dastanng", true},
+		{[]string{"audit:read"}, scopeAuditRead, "dastanng", true},
+		{[]string{"audit:read"}, scopeAuditRead, "", true},
+		{[]string{"audit:read"}, scopeJobsRead, "", false},
+		{[]string{"labels:write:dastanng"}, scopeLabelWrite, "Dastanng", true},
+		{[]string{"labels:write:dastanng"}, scopeLabelWrite, "other", false},
+		// an org scope doesn't cover every org
+		{[]string{"labels:write:dastanng"}, scopeLabelWrite, "", false},
+		{[]string{"labels:write:dastanng", "labels:write:other"}, scopeLabelWrite, "other", true},
+		{[]string{"jobs:read"}, scopeJobsRun, "", false},
+		{nil, scopeJobsRead, "", false},
+	}
+	for _, test := range tests {
+		p := &principal{name: "test", scopes: test.scopes}
+		if got := p.allowed(test.scope, test.owner); got != test.want {
+			t.Errorf("principal with %q: allowed(%s, %q) = %v, want %v", test.scopes, test.scope, test.owner, got, test.want)
+		}
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		valid  bool
+	}{
+		{nil, true},
+		{[]string{"*"}, true},
+		{[]string{"audit:read", "jobs:read", "jobs:run", "labels:write"}, true},
+		{[]string{"labels:write:dastanng"}, true},
+		{[]string{"labels"}, false},
+		{[]string{"labels:read"}, false},
+		{[]string{"labels:write:"}, false},
+		{[]string{"audit:read", "admin"}, false},
+	}
+	for _, test := range tests {
+		if err := validateScopes(test.scopes); (err == nil) != test.valid {
+			t.Errorf("validateScopes(%q) = %v, want valid %v", test.scopes, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/dastanng/gitbot/pkg/bot/glob"
+)
+
+// cmdAreaLabels labels the pullrequest of c by the paths of its changed
+// files. Labels it added before are removed once no file matches them any
+// more, labels added by hand are kept.
+func (b *Bot) cmdAreaLabels(ctx context.Context, c *command) error {
+	paths := b.cfg.AreaLabelsFor(c.owner, c.repo)
+	if len(paths) == 0 {
+		return c.ignore("no area labels configured")
+	}
+	log := c.log()
+
+	files, err := b.prFiles(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	matched := make(map[string]bool)
+	for pattern, label := range paths {
+		for _, f := range files {
+			if glob.Match(pattern, f.GetFilename()) {
+				matched[strings.ToLower(label)] = true
+				break
+			}
+		}
+	}
+	var names []string
+	for l := range matched {
+		names = append(names, l)
+	}
+	sort.Strings(names)
+
+	// never create ad-hoc labels, as commands do
+	known, unknown, err := b.recognizedLabels(ctx, c.owner, c.repo, names...)
+	if err != nil {
+		return err
+	}
+	for _, l := range unknown {
+		log.Warningf("label %s is not recognized, skipped", l)
+	}
+
+	current, err := b.issueLabels(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	has := make(map[string]bool, len(current))
+	for _, l := range current {
+		has[strings.ToLower(l)] = true
+	}
+	var add []string
+	for _, l := range known {
+		if !has[strings.ToLower(l)] {
+			add = append(add, l)
+		}
+	}
+	if len(add) > 0 {
+		if err := b.addLabels(ctx, c, add...); err != nil {
+			return err
+		}
+		log.Infof("added %s", strings.Join(add, ", "))
+	}
+
+	added := b.pluginLabels(c)
+	for _, l := range current {
+		if !added[strings.ToLower(l)] || matched[strings.ToLower(l)] {
+			continue
+		}
+		if err := b.removeLabel(ctx, c, l); err != nil {
+			return err
+		}
+		log.Infof("removed %s", l)
+	}
+	return nil
+}
+
+// pluginLabels returns labels of the issue of c which were last added
+// by plugin c.cmd, according to the audit log
+func (b *Bot) pluginLabels(c *command) map[string]bool {
+	added := make(map[string]bool)
+	for l, cmd := range b.audit.LabelCommands(c.owner, c.repo, c.number) {
+		added[l] = cmd == c.cmd
+	}
+	return added
+}
@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/audit"
+	"github.com/dastanng/gitbot/pkg/bot/config"
+)
+
+func TestAreaLabels(t *testing.T) {
+	ghLabels := func(names ...string) []*github.Label {
+		var list []*github.Label
+		for _, n := range names {
+			list = append(list, &github.Label{Name: github.String(n)})
+		}
+		return list
+	}
+	var added []string
+	b, gh, close := newTestBot(t, map[string]interface{}{
+		"GET /repos/o/r/pulls/1/files": []*github.CommitFile{
+			{Filename: github.String("docs/config.md")},
+			{Filename: github.String("api/v1/types.proto")},
+			{Filename: github.String("web/index.html")},
+		},
+		"GET /repos/o/r/labels":          ghLabels("area/docs", "Area/Api", "area/bot", "area/ui", "area/other"),
+		"GET /repos/o/r/issues/1/labels": ghLabels("area/docs", "Area/Bot", "area/ui"),
+		"POST /repos/o/r/issues/1/labels": func(r *http.Request) (int, interface{}) {
+			json.NewDecoder(r.Body).Decode(&added)
+			return http.StatusOK, ghLabels(added...)
+		},
+		"DELETE /repos/o/r/issues/1/labels/Area/Bot": nil,
+	})
+	defer close()
+	b.cfg.AreaLabels = []config.AreaLabelsConfig{
+		{Repos: []string{"o"}, Paths: map[string]string{"docs/**": "area/other"}},
+		{Repos: []string{"o/r"}, Paths: map[string]string{
+			"docs/":     "area/docs",
+			"*.proto":   "area/API",
+			"web/**":    "area/frontend", // not a label of the repo
+			"pkg/bot/*": "area/bot",
+		}},
+	}
+
+	// area/bot was added by the plugin, area/ui by hand
+	for _, r := range []*audit.Record{
+		{Owner: "o", Repo: "r", Number: 1, Command: areaLabels, Action: "Issues.AddLabelsToIssue",
+			After: []string{"area/docs", "area/bot"}},
+		{Owner: "o", Repo: "r", Number: 1, Command: "/area ui", Action: "Issues.AddLabelsToIssue",
+			Before: []string{"area/docs", "area/bot"}, After: []string{"area/docs", "area/bot", "area/ui"}},
+	} {
+		if err := b.audit.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &command{owner: "o", repo: "r", number: 1, cmd: areaLabels}
+	if err := b.cmdAreaLabels(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Area/Api"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added %q, want %q", added, want)
+	}
+	if got, want := auditActions(t, b)[2:], []string{"Issues.AddLabelsToIssue", "Issues.RemoveLabelForIssue"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got actions %v, want %v", got, want)
+	}
+	if !gh.called("DELETE /repos/o/r/issues/1/labels/Area/Bot") {
+		t.Error("area/bot added by the plugin is kept, no file matches it")
+	}
+}
@@ -0,0 +1,271 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is one mutation made by the bot on behalf of a user
+type Record struct {
+	Time     time.Time `json:"time"`
+	Delivery string    `json:"delivery,omitempty"` // github delivery id
+
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number,omitempty"`
+
+	User       string `json:"user,omitempty"`        // user who triggered the action
+	CommentURL string `json:"comment_url,omitempty"` // comment carrying the command
+	Command    string `json:"command"`               // command line, e.g. "/hold cancel"
+	Action     string `json:"action"`                // GitHub API call, e.g. "Issues.AddLabelsToIssue"
+
+	// Before and After are the labels, assignees or state touched by Action
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// Query filters records, zero fields match everything
+type Query struct {
+	Owner  string
+	Repo   string
+	Number int
+	User   string
+	// Limit keeps the latest Limit records
+	Limit int
+}
+
+// Match returns whether r satisfies q
+func (q *Query) Match(r *Record) bool {
+	if len(q.Owner) > 0 && !strings.EqualFold(q.Owner, r.Owner) {
+		return false
+	}
+	if len(q.Repo) > 0 && !strings.EqualFold(q.Repo, r.Repo) {
+		return false
+	}
+	if q.Number > 0 && q.Number != r.Number {
+		return false
+	}
+	if len(q.User) > 0 && !strings.EqualFold(q.User, r.User) {
+		return false
+	}
+	return true
+}
+
+// Store is an append-only audit log, one json record per line
+type Store struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	// size is the length of the log, queries read up to the size at which
+	// they start, so that they don't need to hold mu
+	size int64
+	// torn is set when a write failed halfway, the next record starts on
+	// a new line
+	torn bool
+	// labels indexes the command which last added each label of an
+	// issue, so that it needn't be looked up by scanning the log
+	labels map[string]map[string]string
+}
+
+// Open opens the audit log at path, creating it if necessary. A torn line
+// left by a crash is terminated, so that it's skipped rather than glued to
+// the next record.
+func Open(path string) (*Store, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{path: path, f: f, labels: make(map[string]map[string]string)}
+	if err := s.open(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) open() error {
+	fi, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	s.size = fi.Size()
+	if s.size > 0 {
+		last := make([]byte, 1)
+		if _, err := s.f.ReadAt(last, s.size-1); err != nil {
+			return err
+		}
+		if last[0] != '\n' {
+			if _, err := s.f.Write([]byte{'\n'}); err != nil {
+				return err
+			}
+			s.size++
+		}
+	}
+	return scanFile(s.path, s.size, s.index)
+}
+
+// Append writes r to the end of the log and syncs it to disk
+func (s *Store) Append(r *Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	line := append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.torn {
+		line = append([]byte{'\n'}, line...)
+	}
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		s.torn = n > 0
+		return err
+	}
+	s.torn = false
+	s.index(r)
+	return s.f.Sync()
+}
+
+// LabelCommands returns the command which last added each label of an
+// issue, by lowercase label name. Labels removed since are left out.
+func (s *Store) LabelCommands(owner, repo string, number int) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	commands := make(map[string]string)
+	for l, cmd := range s.labels[issueKey(owner, repo, number)] {
+		commands[l] = cmd
+	}
+	return commands
+}
+
+// index updates the label index by r
+func (s *Store) index(r *Record) {
+	var added, removed []string
+	switch r.Action {
+	case "Issues.AddLabelsToIssue":
+		added = diffNames(r.After, r.Before)
+	case "Issues.RemoveLabelForIssue":
+		removed = diffNames(r.Before, r.After)
+	default:
+		return
+	}
+	key := issueKey(r.Owner, r.Repo, r.Number)
+	labels := s.labels[key]
+	if labels == nil {
+		labels = make(map[string]string)
+		s.labels[key] = labels
+	}
+	for _, l := range added {
+		labels[l] = r.Command
+	}
+	for _, l := range removed {
+		delete(labels, l)
+	}
+	if len(labels) == 0 {
+		delete(s.labels, key)
+	}
+}
+
+// issueKey is the index key of an issue
+func issueKey(owner, repo string, number int) string {
+	return strings.ToLower(owner+"/"+repo) + "#" + strconv.Itoa(number)
+}
+
+// diffNames returns lowercase names in a but not in b
+func diffNames(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, n := range b {
+		in[strings.ToLower(n)] = true
+	}
+	var diff []string
+	for _, n := range a {
+		if !in[strings.ToLower(n)] {
+			diff = append(diff, strings.ToLower(n))
+		}
+	}
+	return diff
+}
+
+// Query returns records matching q, oldest first. Records appended while
+// the log is read are left out.
+func (s *Store) Query(q Query) ([]*Record, error) {
+	s.mu.Lock()
+	size := s.size
+	s.mu.Unlock()
+	return read(s.path, size, q)
+}
+
+// Close closes the log
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// Read scans the audit log at path and returns records matching q, oldest first.
+// It doesn't need an open Store, so a log can be inspected offline.
+func Read(path string, q Query) ([]*Record, error) {
+	return read(path, -1, q)
+}
+
+// read returns records matching q of the first size bytes of the log at
+// path, or of the whole log if size is negative
+func read(path string, size int64, q Query) ([]*Record, error) {
+	var records []*Record
+	err := scanFile(path, size, func(r *Record) {
+		if !q.Match(r) {
+			return
+		}
+		records = append(records, r)
+		if q.Limit > 0 && len(records) > q.Limit {
+			records = records[1:]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// scanFile calls fn with every record of the first size bytes of the audit
+// log at path, or of the whole log if size is negative, oldest first
+func scanFile(path string, size int64, fn func(*Record)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if size >= 0 {
+		r = io.LimitReader(f, size)
+	}
+	return scan(r, fn)
+}
+
+// scan calls fn with every record read from in
+func scan(in io.Reader, fn func(*Record)) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		r := new(Record)
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			// skip torn line left by a crash
+			continue
+		}
+		fn(r)
+	}
+	return scanner.Err()
+}
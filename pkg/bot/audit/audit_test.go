@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func tempLog(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "audit.jsonl")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func actions(records []*Record) []string {
+	var got []string
+	for _, r := range records {
+		got = append(got, r.Action)
+	}
+	return got
+}
+
+func TestMatch(t *testing.T) {
+	r := &Record{Owner: "dastanng", Repo: "gitbot", Number: 7, User: "alice"}
+	tests := []struct {
+		name string
+		q    Query
+		want bool
+	}{
+		{"empty", Query{}, true},
+		{"repo", Query{Owner: "Dastanng", Repo: "GitBot"}, true},
+		{"other repo", Query{Owner: "dastanng", Repo: "other"}, false},
+		{"other owner", Query{Owner: "dunjut"}, false},
+		{"number", Query{Number: 7}, true},
+		{"other number", Query{Number: 8}, false},
+		{"user", Query{User: "ALICE"}, true},
+		{"other user", Query{User: "bob"}, false},
+	}
+	for _, test := range tests {
+		if got := test.q.Match(r); got != test.want {
+			t.Errorf("%s: Match = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAppendQuery(t *testing.T) {
+	path := tempLog(t, "")
+	defer os.RemoveAll(filepath.Dir(path))
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, r := range []*Record{
+		{Owner: "dastanng", Repo: "gitbot", Number: 1, User: "alice", Action: "a"},
+		{Owner: "dastanng", Repo: "gitbot", Number: 2, User: "bob", Action: "b"},
+		{Owner: "dastanng", Repo: "other", Number: 1, User: "alice", Action: "c"},
+		{Owner: "dastanng", Repo: "gitbot", Number: 1, User: "bob", Action: "d"},
+	} {
+		if err := s.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"all", Query{}, []string{"a", "b", "c", "d"}},
+		{"issue", Query{Owner: "dastanng", Repo: "gitbot", Number: 1}, []string{"a", "d"}},
+		{"user", Query{User: "alice"}, []string{"a", "c"}},
+		{"latest", Query{Limit: 2}, []string{"c", "d"}},
+		{"latest of user", Query{User: "bob", Limit: 1}, []string{"d"}},
+		{"none", Query{User: "carol"}, nil},
+	}
+	for _, test := range tests {
+		records, err := s.Query(test.q)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := actions(records); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+		if records, _ = Read(path, test.q); !reflect.DeepEqual(actions(records), test.want) {
+			t.Errorf("%s: Read got %q, want %q", test.name, actions(records), test.want)
+		}
+	}
+}
+
+func TestLabelCommands(t *testing.T) {
+	path := tempLog(t, "")
+	defer os.RemoveAll(filepath.Dir(path))
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []*Record{
+		{Owner: "dastanng", Repo: "gitbot", Number: 1, Command: "/kind bug", Action: "Issues.AddLabelsToIssue",
+			Before: []string{"lgtm"}, After: []string{"lgtm", "kind/bug"}},
+		{Owner: "dastanng", Repo: "gitbot", Number: 1, Command: "area-labels", Action: "Issues.AddLabelsToIssue",
+			After: []string{"Area/Docs", "area/api"}},
+		{Owner: "dastanng", Repo: "gitbot", Number: 1, Command: "area-labels", Action: "Issues.RemoveLabelForIssue",
+			Before: []string{"area/api", "area/docs"}, After: []string{"area/docs"}},
+		{Owner: "dastanng", Repo: "gitbot", Number: 1, Command: "/close", Action: "Issues.Edit"},
+		{Owner: "dastanng", Repo: "gitbot", Number: 2, Command: "/kind bug", Action: "Issues.AddLabelsToIssue",
+			After: []string{"kind/bug"}},
+	} {
+		if err := s.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{"kind/bug": "/kind bug", "area/docs": "area-labels"}
+	if got := s.LabelCommands("Dastanng", "gitbot", 1); !reflect.DeepEqual(got, want) {
+		t.Errorf("LabelCommands = %v, want %v", got, want)
+	}
+	s.Close()
+
+	// the index is rebuilt from the log
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := s.LabelCommands("dastanng", "gitbot", 1); !reflect.DeepEqual(got, want) {
+		t.Errorf("reopened: LabelCommands = %v, want %v", got, want)
+	}
+	if got := s.LabelCommands("dastanng", "gitbot", 3); len(got) != 0 {
+		t.Errorf("unknown issue: LabelCommands = %v, want none", got)
+	}
+}
+
+func TestOpenTornLine(t *testing.T) {
+	path := tempLog(t, `{"owner":"dastanng","repo":"gitbot","action":"a"}`+"\n"+`{"owner":"dastanng","re`)
+	defer os.RemoveAll(filepath.Dir(path))
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Append(&Record{Owner: "dastanng", Repo: "gitbot", Action: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := s.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := actions(records), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
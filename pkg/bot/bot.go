@@ -2,65 +2,239 @@ package bot
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
 	"net/http"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/golang/glog"
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
 	"k8s.io/client-go/util/workqueue"
+
+	"github.com/dastanng/gitbot/pkg/bot/audit"
+	"github.com/dastanng/gitbot/pkg/bot/config"
+	"github.com/dastanng/gitbot/pkg/bot/labels"
+	"github.com/dastanng/gitbot/pkg/bot/queue"
+	"github.com/dastanng/gitbot/pkg/bot/scheduler"
 )
 
 // Bot struct
 type Bot struct {
 	secret string
+	cfg    *config.Config
 	git    *github.Client
-	queue  workqueue.RateLimitingInterface
-	cmds   map[string]func(*command) bool
+	queue  *queue.FairQueue
+	cmds   map[string]handler
+	audit  *audit.Store
+	seen   *seenCache
+
+	presets *labels.Presets
+	jobs    *scheduler.Scheduler
+
+	// principals are the clients allowed to use the admin api
+	principals []*principal
+
+	// ctx is the parent of every command context, it's canceled on shutdown
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
 }
 
+// plugins
+const (
+	// presetLabels adds preset labels to a new repo
+	presetLabels = "preset-labels"
+	// sizeLabel labels a pullrequest by its size
+	sizeLabel = "size"
+	// areaLabels labels a pullrequest by paths of changed files
+	areaLabels = "area-labels"
+	// autoReviewers requests reviews on a new pullrequest
+	autoReviewers = "reviewers"
+	// needsRebase labels a pullrequest having conflicts
+	needsRebase = "needs-rebase"
+	// needsRebaseBranch checks pullrequests of a pushed base branch
+	needsRebaseBranch = "needs-rebase-branch"
+	// releaseNoteLabel labels a pullrequest by its release note
+	releaseNoteLabel = "release-note"
+	// dcoCheck checks sign-offs of the commits of a pullrequest
+	dcoCheck = "dco"
+	// policyCheck checks a pullrequest against the policy of its repo
+	policyCheck = "policy"
+	// cherryPickMerged runs /cherry-pick commands of a merged pullrequest
+	cherryPickMerged = "cherry-pick-merged"
+)
+
+// handler runs a command. Returned errors are classified by isRetryable.
+type handler func(context.Context, *command) error
+
 // InitOptions struct
 type InitOptions struct {
-	Token  string
-	Secret string
+	Token      string
+	Secret     string
+	ConfigFile string
+	LogFormat  string // text or json
+	AdminToken string
+	// PresetsFile overrides the global preset file of config
+	PresetsFile string
 }
 
 // Initialize bot
-func (b *Bot) Initialize(opts InitOptions) {
+func (b *Bot) Initialize(opts InitOptions) error {
 	b.secret = opts.Secret
 
+	switch opts.LogFormat {
+	case "", LogFormatText:
+	case LogFormatJSON:
+		jsonLogs = true
+	default:
+		return fmt.Errorf("unknown log format %q", opts.LogFormat)
+	}
+
+	// load config and preset labels
+	if err := b.loadConfig(opts); err != nil {
+		return err
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	var err error
+	if b.principals, err = loadPrincipals(b.cfg.Admin, opts.AdminToken); err != nil {
+		return err
+	}
+
+	// open audit log
+	if b.audit, err = audit.Open(b.cfg.Audit.Path); err != nil {
+		return err
+	}
+
 	// initialize Github client
 	b.git = initializeGitClient(opts.Token)
 
-	// initialize working queue
-	b.queue = workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(
+	// initialize working queue, commands are scheduled fairly across repos
+	b.queue = queue.NewFairQueue(b.cfg.Queue.Capacity, b.tenantOf, workqueue.NewItemExponentialFailureRateLimiter(
 		100*time.Millisecond,
 		5*time.Second,
 	))
 
+	// reviewers are picked at random
+	rand.Seed(time.Now().UnixNano())
+
+	// periodic jobs are run until shutdown
+	b.jobs = scheduler.New(b.ctx, jobDone)
+	if err := b.registerJobs(); err != nil {
+		return err
+	}
+
+	// remember commands run from comments for a day
+	b.seen = newSeenCache(24 * time.Hour)
+
 	// initialize command handlers
-	b.cmds = map[string]func(*command) bool{
-		"/close":       b.cmdClose,
-		"/assign":      b.cmdAssign,
-		"/unassign":    b.cmdAssign,
-		"/cc":          b.cmdCc,
-		"/uncc":        b.cmdCc,
-		"/hold":        b.cmdHold,
-		"/wip":         b.cmdWip,
-		"/kind":        b.cmdLabel,
-		"/remove-kind": b.cmdLabel,
-		"/area":        b.cmdLabel,
-		"/remove-area": b.cmdLabel,
-		"/task":        b.cmdLabel,
-		"/remove-task": b.cmdLabel,
-		"/lgtm":        b.cmdLgtm,
+	b.cmds = map[string]handler{
+		"/close":     b.cmdClose,
+		"/reopen":    b.cmdClose,
+		"/retitle":   b.cmdRetitle,
+		"/lock":      b.cmdLock,
+		"/unlock":    b.cmdLock,
+		"/assign":    b.cmdAssign,
+		"/unassign":  b.cmdAssign,
+		"/cc":        b.cmdCc,
+		"/uncc":      b.cmdCc,
+		"/hold":      b.cmdHold,
+		"/wip":       b.cmdWip,
+		"/lgtm":      b.cmdLgtm,
+		"/retest":    b.cmdTest,
+		"/test":      b.cmdTest,
+		"/milestone": b.cmdMilestone,
+
+		"/cherry-pick":       b.cmdCherryPick,
+		"/release-note-none": b.cmdReleaseNoteNone,
+
+		"/lifecycle":        b.cmdLifecycle,
+		"/remove-lifecycle": b.cmdLifecycle,
+
+		// plugins triggered by events, they have no leading '/'
+		// so that they can't be triggered from comments
+		presetLabels:      b.addPresetLabels,
+		sizeLabel:         b.cmdSize,
+		areaLabels:        b.cmdAreaLabels,
+		autoReviewers:     b.cmdReviewers,
+		needsRebase:       b.cmdNeedsRebase,
+		needsRebaseBranch: b.cmdNeedsRebaseBranch,
+		releaseNoteLabel:  b.cmdReleaseNote,
+		dcoCheck:          b.cmdDCO,
+		policyCheck:       b.cmdPolicy,
+		cherryPickMerged:  b.cmdCherryPickMerged,
+	}
+	if err := b.registerLabelCategories(); err != nil {
+		return err
+	}
+	if err := b.validatePolicies(); err != nil {
+		return err
 	}
 
-	// register webhook handlers
-	b.registerHandlers()
+	log.Info("webhook server initialized.")
+	return nil
+}
 
-	glog.Info("webhook server initialized.")
+// InitializeClient prepares bot for a one-shot cli command, e.g. labels
+// sync: only config, preset labels and the Github client are loaded. The
+// audit log is opened if audited is set, commands which don't write to
+// GitHub leave it alone.
+func (b *Bot) InitializeClient(opts InitOptions, audited bool) error {
+	if err := b.loadConfig(opts); err != nil {
+		return err
+	}
+	if audited {
+		var err error
+		if b.audit, err = audit.Open(b.cfg.Audit.Path); err != nil {
+			return err
+		}
+	}
+	b.git = initializeGitClient(opts.Token)
+	return nil
+}
+
+// loadConfig loads config and preset labels
+func (b *Bot) loadConfig(opts InitOptions) error {
+	cfg, err := config.Load(opts.ConfigFile)
+	if err != nil {
+		return err
+	}
+	b.cfg = cfg
+	if len(opts.PresetsFile) > 0 {
+		b.cfg.Presets.File = opts.PresetsFile
+	}
+	p := b.cfg.Presets
+	b.presets, err = labels.LoadPresets(p.File, p.Orgs, p.Repos)
+	return err
+}
+
+// registerLabelCategories adds commands of configured label categories
+func (b *Bot) registerLabelCategories() error {
+	registered := make(map[string]bool)
+	for _, lc := range b.cfg.LabelCategories {
+		name := strings.ToLower(lc.Name)
+		if !cmdName.MatchString("/" + name) {
+			return fmt.Errorf("label category %q: invalid name", lc.Name)
+		}
+		for _, role := range lc.Roles {
+			switch strings.ToLower(role) {
+			case roleAuthor, roleMember, roleCollaborator, roleMaintainer:
+			default:
+				return fmt.Errorf("label category %s: unknown role %q", lc.Name, role)
+			}
+		}
+		for _, cmd := range []string{"/" + name, "/remove-" + name} {
+			// a category may be configured once per repo
+			if _, ok := b.cmds[cmd]; ok && !registered[cmd] {
+				return fmt.Errorf("label category %s: command %s already exists", lc.Name, cmd)
+			}
+			b.cmds[cmd] = b.cmdLabel
+			registered[cmd] = true
+		}
+	}
+	return nil
 }
 
 // Run starts the webhook server.
@@ -69,59 +243,126 @@ func (b *Bot) Run(stopCh <-chan struct{}) {
 	go func() {
 		<-stopCh
 		shutdown = true
-		glog.Info("receiving stop signal, shutting down server...")
-		for {
-			if atomic.LoadInt32(&processing) == 0 {
-				glog.Fatalln("webhook server terminated by signal.")
-			}
+		log.Info("receiving stop signal, shutting down server...")
+		for atomic.LoadInt32(&processing) != 0 {
 			time.Sleep(time.Millisecond * 10)
 		}
+		// interrupt in-flight GitHub requests and wait for workers
+		b.cancel()
+		b.queue.ShutDown()
+		b.workers.Wait()
+		log.Fatalf("webhook server terminated by signal.")
 	}()
 
-	go b.worker()
+	for i := 0; i < b.cfg.Queue.Workers; i++ {
+		b.workers.Add(1)
+		go b.worker()
+	}
+
+	// start periodic jobs
+	b.jobs.Start(stopCh)
+
+	// the admin api is served on its own address, so that it can be
+	// kept private while webhooks are public
+	if len(b.principals) > 0 {
+		go func() {
+			err := b.serveAdmin()
+			log.Fatalf("admin api terminated: %v", err)
+		}()
+	} else {
+		log.Info("admin api disabled, no token or client configured")
+	}
+
+	// register webhook handlers
+	b.registerHandlers()
 
-	glog.Info("webhook server started, listening on 0.0.0.0:11111")
+	log.Info("webhook server started, listening on 0.0.0.0:11111")
 	err := http.ListenAndServe(":11111", nil)
-	glog.Fatalf("webhook server terminated: %v", err)
+	log.Fatalf("webhook server terminated: %v", err)
 }
 
 func (b *Bot) registerHandlers() {
 	http.HandleFunc("/webhook", b.handleWebhook)
-	http.HandleFunc("/api/labels", b.handleAddPresetLabels)
 }
 
 func (b *Bot) worker() {
-	for {
-		b.processNextItem()
+	defer b.workers.Done()
+	for b.processNextItem() {
 	}
 }
 
+// tenantOf schedules commands by owner, then by owner/repo
+func (b *Bot) tenantOf(item interface{}) (queue.Tenant, queue.Tenant) {
+	c := item.(*command)
+	org := queue.Tenant{Key: strings.ToLower(c.owner)}
+	org.Weight, org.Concurrency = b.cfg.Queue.Org(c.owner)
+	repo := queue.Tenant{Key: strings.ToLower(c.owner + "/" + c.repo)}
+	repo.Weight, repo.Concurrency = b.cfg.Queue.Tenant(c.owner, c.repo)
+	return org, repo
+}
+
 // processNextItem fetches a command from queue and reacts.
-func (b *Bot) processNextItem() {
+// It returns false when the queue is shut down.
+func (b *Bot) processNextItem() bool {
 	// wait until there is new item in the working queue
-	item, _ := b.queue.Get()
+	item, quit := b.queue.Get()
+	if quit {
+		return false
+	}
 	defer b.queue.Done(item)
 
 	c := item.(*command)
+	log := c.log().with("attempt", b.queue.NumRequeues(item)+1)
 	f, ok := b.cmds[c.cmd]
 	if !ok {
 		// invalid command, ignore
 		b.queue.Forget(item)
-		return
+		log.with("outcome", "unknown").Info("unknown command")
+		return true
 	}
 
 	// try to run corresponding command
-	if f(c) {
+	ctx, cancel := context.WithTimeout(b.ctx, b.cfg.Command.Timeout)
+	defer cancel()
+	err := f(ctx, c)
+	if err == nil {
+		b.queue.Forget(item)
+		log.with("outcome", "succeed").Info("command succeed")
+		return true
+	}
+	if e, ok := err.(*skippedError); ok {
 		b.queue.Forget(item)
-		return
+		log.with("outcome", e.outcome).Infof("command %s: %s", e.outcome, e.reason)
+		return true
 	}
 
-	// failed running command, retry
-	if b.queue.NumRequeues(item) < 10 {
+	// failed running command, retry if the error is transient
+	if isRetryable(err) && b.queue.NumRequeues(item) < 10 {
+		log.with("outcome", "retry").Warningf("command failed, retrying: %v", err)
 		b.queue.AddRateLimited(item)
 	} else {
+		log.with("outcome", "failed").Errorf("command failed: %v", err)
 		b.queue.Forget(item)
 	}
+	return true
+}
+
+// fanOut queues cmds spawned by c, as many as the queue has room for. The
+// rest are kept on c, which is retried with backoff to queue them, so that
+// a fan-out larger than the room left is queued in chunks rather than not
+// at all.
+func (b *Bot) fanOut(c *command, cmds []*command) error {
+	items := make([]interface{}, 0, len(cmds))
+	for _, cmd := range cmds {
+		items = append(items, cmd)
+	}
+	n := b.queue.AddSome(items...)
+	if n < len(cmds) {
+		c.pending = cmds[n:]
+		return retryable(fmt.Errorf("%v, %d of %d command(s) left to queue", queue.ErrFull, len(c.pending), len(cmds)))
+	}
+	c.pending = nil
+	return nil
 }
 
 func initializeGitClient(token string) *github.Client {
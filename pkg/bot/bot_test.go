@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/config"
+)
+
+func TestRegisterLabelCategories(t *testing.T) {
+	tests := []struct {
+		name       string
+		categories []config.LabelCategory
+		err        string
+	}{
+		{name: "default", categories: []config.LabelCategory{{Name: "kind"}, {Name: "area"}}},
+		{name: "per repo", categories: []config.LabelCategory{
+			{Name: "kind", Repos: []string{"o/a"}},
+			{Name: "Kind", Repos: []string{"o/b"}, Exclusive: true},
+		}},
+		{name: "roles", categories: []config.LabelCategory{{Name: "priority", Roles: []string{"Author", "member", "collaborator", "maintainer"}}}},
+		{name: "unknown role", categories: []config.LabelCategory{{Name: "priority", Roles: []string{"owner"}}},
+			err: `label category priority: unknown role "owner"`},
+		{name: "invalid name", categories: []config.LabelCategory{{Name: "bad name"}},
+			err: `label category "bad name": invalid name`},
+		{name: "command", categories: []config.LabelCategory{{Name: "lgtm"}},
+			err: "label category lgtm: command /lgtm already exists"},
+		{name: "remove command", categories: []config.LabelCategory{{Name: "lifecycle"}},
+			err: "label category lifecycle: command /lifecycle already exists"},
+	}
+	for _, test := range tests {
+		b := &Bot{cfg: &config.Config{LabelCategories: test.categories}}
+		b.cmds = map[string]handler{
+			"/lgtm":             b.cmdLgtm,
+			"/lifecycle":        b.cmdLifecycle,
+			"/remove-lifecycle": b.cmdLifecycle,
+		}
+		err := b.registerLabelCategories()
+		if test.err == "" && err != nil || test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		for _, lc := range test.categories {
+			for _, cmd := range []string{"/" + lc.Name, "/remove-" + lc.Name} {
+				if _, ok := b.cmds[strings.ToLower(cmd)]; !ok {
+					t.Errorf("%s: %s is not registered", test.name, cmd)
+				}
+			}
+		}
+	}
+}
+
+func TestLabelRoles(t *testing.T) {
+	tests := []struct {
+		user string
+		err  error
+		want []string // audited actions
+	}{
+		{user: "collab", want: []string{"Issues.AddLabelsToIssue"}},
+		{user: "author", want: []string{"Issues.AddLabelsToIssue"}},
+		{user: "other", err: &skippedError{outcome: "ignored", reason: "user other is not author or collaborator"}},
+	}
+	for _, test := range tests {
+		b, _, close := newTestBot(t, withRoutes(map[string]interface{}{
+			"GET /repos/o/r/labels":           []*github.Label{{Name: github.String("priority/high")}},
+			"GET /repos/o/r/issues/1/labels":  []*github.Label{},
+			"POST /repos/o/r/issues/1/labels": []*github.Label{{Name: github.String("priority/high")}},
+		}))
+		b.cfg.LabelCategories = []config.LabelCategory{{Name: "priority", Roles: []string{"author", "collaborator"}}}
+
+		c := &command{owner: "o", repo: "r", number: 1, author: "author", user: test.user, cmd: "/priority", args: []string{"high"}}
+		if err := b.cmdLabel(context.Background(), c); !reflect.DeepEqual(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", test.user, err, test.err)
+		}
+		if got := auditActions(t, b); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got actions %v, want %v", test.user, got, test.want)
+		}
+		close()
+	}
+}
@@ -0,0 +1,497 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// cherryPickLabels are categories of labels copied to a cherry-pick
+var cherryPickLabels = []string{"kind", "area"}
+
+// cmdCherryPick handles command /cherry-pick <branch>. On a merged
+// pullrequest the commits are recreated on top of branch and a new
+// pullrequest is opened, on an open one the cherry-pick runs once it is
+// merged, see cmdCherryPickMerged.
+func (b *Bot) cmdCherryPick(ctx context.Context, c *command) error {
+	// check command syntax
+	if len(c.args) != 1 {
+		return c.invalid()
+	}
+	branch := c.args[0]
+
+	// validates if user is a 'member' or 'collaborator' of owner/repo
+	isMember, err := b.isMember(ctx, c.owner, c.repo, c.user)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return c.ignore("user %s is not a member or collaborator", c.user)
+	}
+
+	pr, resp, err := b.git.PullRequests.Get(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return c.ignore("%d is not a pullrequest", c.number)
+		}
+		return err
+	}
+	if _, resp, err := b.git.Repositories.GetBranch(ctx, c.owner, c.repo, branch); err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return b.comment(ctx, c, fmt.Sprintf("@%s: branch `%s` doesn't exist, nothing to cherry-pick onto.", c.user, branch))
+		}
+		return err
+	}
+	if strings.EqualFold(pr.Base.GetRef(), branch) {
+		return c.ignore("pullrequest is based on %s already", branch)
+	}
+
+	switch {
+	case pr.GetMerged():
+		return b.cherryPick(ctx, c, pr, branch)
+	case pr.GetState() == "open":
+		return b.comment(ctx, c, fmt.Sprintf("@%s: once this PR is merged, I will cherry-pick it onto `%s`.", c.user, branch))
+	default:
+		return c.ignore("pullrequest is closed without being merged")
+	}
+}
+
+// cmdCherryPickMerged runs the /cherry-pick commands left on a pullrequest
+// before it was merged, one queued command per branch, so that a failing
+// branch is retried without redoing the others. A branch requested more
+// than once is cherry-picked once.
+func (b *Bot) cmdCherryPickMerged(ctx context.Context, c *command) error {
+	e, ok := c.event.(*github.PullRequestEvent)
+	if !ok {
+		return c.invalid()
+	}
+	pr := e.PullRequest
+	if !pr.GetMerged() {
+		return c.ignore("pullrequest is not merged")
+	}
+	if c.pending != nil {
+		// comments were read by an earlier attempt
+		return b.fanOut(c, c.pending)
+	}
+
+	// commands in the description count as the author's
+	var cmds []*command
+	for _, cmd := range parseCommentBody(pr.GetBody()) {
+		cmd.user = c.author
+		cmds = append(cmds, cmd)
+	}
+	opt := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{Page: 1, PerPage: 100}}
+	for opt.Page > 0 {
+		comments, resp, err := b.git.Issues.ListComments(ctx, c.owner, c.repo, c.number, opt)
+		if err != nil {
+			return err
+		}
+		for _, comment := range comments {
+			for _, cmd := range parseCommentBody(comment.GetBody()) {
+				cmd.user = comment.User.GetLogin()
+				cmd.url = comment.GetHTMLURL()
+				cmds = append(cmds, cmd)
+			}
+		}
+		opt.Page = resp.NextPage
+	}
+
+	// permissions are checked by each command
+	var items []*command
+	done := make(map[string]bool)
+	for _, cmd := range cmds {
+		// branch names are case-sensitive
+		if cmd.cmd != "/cherry-pick" || len(cmd.args) != 1 || done[cmd.args[0]] {
+			continue
+		}
+		done[cmd.args[0]] = true
+		items = append(items, &command{
+			owner:     c.owner,
+			ownerType: c.ownerType,
+			repo:      c.repo,
+			number:    c.number,
+			author:    c.author,
+			user:      cmd.user,
+			cmd:       cmd.cmd,
+			args:      cmd.args,
+			url:       cmd.url,
+			event:     c.event,
+			eventType: c.eventType,
+			delivery:  c.delivery,
+		})
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	c.log().Infof("queueing %d cherry-pick(s)", len(items))
+	return b.fanOut(c, items)
+}
+
+// cherryPick recreates the commits of pr on top of branch by the git data
+// API and opens a pullrequest of them. Commits are applied file by file: a
+// file changed by a commit conflicts if branch doesn't have the content the
+// commit started from. On conflicts, or merge commits among those of pr,
+// nothing is pushed, the user is told to cherry-pick by hand instead. A cherry-pick branch left by an earlier
+// run is never overwritten, it may carry fixes pushed by hand.
+func (b *Bot) cherryPick(ctx context.Context, c *command, pr *github.PullRequest, branch string) error {
+	commits, err := b.prCommits(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return c.ignore("pullrequest has no commits")
+	}
+
+	name := fmt.Sprintf("cherry-pick-%d-to-%s", c.number, branch)
+	existing, resp, err := b.git.Repositories.GetBranch(ctx, c.owner, c.repo, name)
+	switch {
+	case err == nil:
+		return b.existingCherryPick(ctx, c, pr, commits, existing, branch)
+	case resp == nil || resp.StatusCode != http.StatusNotFound:
+		return err
+	}
+
+	for _, rc := range commits {
+		// the changes of a merge commit depend on which parent it is
+		// compared to, git cherry-pick needs -m to be told
+		if len(rc.Parents) > 1 {
+			return b.comment(ctx, c, fmt.Sprintf("@%s: this PR has merge commit %s, it can't be cherry-picked onto `%s` automatically. Please cherry-pick it by hand.", c.user, rc.GetSHA(), branch))
+		}
+	}
+
+	ref, _, err := b.git.Git.GetRef(ctx, c.owner, c.repo, "heads/"+branch)
+	if err != nil {
+		return err
+	}
+	head := ref.Object.GetSHA()
+	base, _, err := b.git.Git.GetCommit(ctx, c.owner, c.repo, head)
+	if err != nil {
+		return err
+	}
+	treeSHA := base.Tree.GetSHA()
+	// only files changed by the commits are looked up, target holds those
+	// changed on branch so far
+	trees := &treeCache{bot: b, owner: c.owner, repo: c.repo, trees: make(map[string]*github.Tree)}
+	target := make(map[string]*github.TreeEntry)
+	targetEntry := func(p string) (*github.TreeEntry, error) {
+		if e, ok := target[p]; ok {
+			return e, nil
+		}
+		return trees.entry(ctx, base.Tree.GetSHA(), p)
+	}
+
+	var conflicts []string
+	for _, rc := range commits {
+		if len(rc.Parents) == 0 {
+			return permanent(fmt.Errorf("commit %s has no parent", rc.GetSHA()))
+		}
+		paths, err := b.commitPaths(ctx, c.owner, c.repo, rc.GetSHA())
+		if err != nil {
+			return err
+		}
+
+		var entries []treeChange
+		for _, p := range paths {
+			from, err := trees.entry(ctx, rc.Parents[0].GetSHA(), p)
+			if err != nil {
+				return err
+			}
+			to, err := trees.entry(ctx, rc.Commit.Tree.GetSHA(), p)
+			if err != nil {
+				return err
+			}
+			cur, err := targetEntry(p)
+			if err != nil {
+				return err
+			}
+			switch {
+			case sameEntry(from, to):
+				// e.g. a mode change reverted within the commit
+				continue
+			case sameEntry(cur, to):
+				// already on branch
+				continue
+			case !sameEntry(cur, from):
+				conflicts = append(conflicts, p)
+				continue
+			}
+			entries = append(entries, newTreeChange(p, to, from))
+			target[p] = to
+		}
+		if len(conflicts) > 0 {
+			break
+		}
+		if len(entries) == 0 {
+			// nothing left of the commit, as git cherry-pick would skip it
+			continue
+		}
+
+		tree, err := b.createTree(ctx, c, treeSHA, entries)
+		if err != nil {
+			return err
+		}
+		commit, err := b.createCommit(ctx, c, &github.Commit{
+			Author:  rc.Commit.Author,
+			Message: github.String(fmt.Sprintf("%s\n\n(cherry picked from commit %s)", strings.TrimRight(rc.Commit.GetMessage(), "\n"), rc.GetSHA())),
+			Tree:    tree,
+			Parents: []github.Commit{{SHA: github.String(head)}},
+		})
+		if err != nil {
+			return err
+		}
+		head, treeSHA = commit.GetSHA(), tree.GetSHA()
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		c.log().Infof("cherry-pick onto %s conflicts in %d file(s)", branch, len(conflicts))
+		return b.comment(ctx, c, cherryPickConflict(c, branch, commits, conflicts))
+	}
+	if head == ref.Object.GetSHA() {
+		return b.comment(ctx, c, fmt.Sprintf("@%s: every change of this PR is on `%s` already, nothing to cherry-pick.", c.user, branch))
+	}
+
+	if err := b.createBranch(ctx, c, name, head); err != nil {
+		return err
+	}
+	return b.openCherryPick(ctx, c, pr, name, branch)
+}
+
+// existingCherryPick handles a cherry-pick branch which exists already. If
+// it has an open pullrequest, or was pushed by an earlier run which failed
+// before opening one (as told by the "cherry picked from" line of its head),
+// the pullrequest is reported (or opened) as is. Otherwise the user is asked
+// to delete the branch.
+func (b *Bot) existingCherryPick(ctx context.Context, c *command, pr *github.PullRequest, commits []*github.RepositoryCommit, existing *github.Branch, branch string) error {
+	name := existing.GetName()
+	open, err := b.openPullRequests(ctx, c.owner, c.repo, name, branch)
+	if err != nil {
+		return err
+	}
+	if len(open) > 0 {
+		return b.openCherryPick(ctx, c, pr, name, branch)
+	}
+	message := existing.Commit.Commit.GetMessage()
+	for _, rc := range commits {
+		if strings.Contains(message, "(cherry picked from commit "+rc.GetSHA()+")") {
+			return b.openCherryPick(ctx, c, pr, name, branch)
+		}
+	}
+	return b.comment(ctx, c, fmt.Sprintf("@%s: branch `%s` exists already and has no open PR, delete it to cherry-pick again.", c.user, name))
+}
+
+// openCherryPick opens the pullrequest of cherry-pick branch head onto
+// branch, copying labels of pr, and tells the user
+func (b *Bot) openCherryPick(ctx context.Context, c *command, pr *github.PullRequest, head, branch string) error {
+	newPR, err := b.cherryPickPR(ctx, c, pr, head, branch)
+	if err != nil {
+		return err
+	}
+
+	// copy labels, e.g. kind/bug, to the new pullrequest
+	var copied []string
+	for _, l := range labelNames(pr.Labels) {
+		for _, category := range cherryPickLabels {
+			if strings.HasPrefix(strings.ToLower(l), category+"/") {
+				copied = append(copied, l)
+				break
+			}
+		}
+	}
+	if len(copied) > 0 {
+		onNew := *c
+		onNew.number = newPR.GetNumber()
+		if err := b.addLabels(ctx, &onNew, copied...); err != nil {
+			return err
+		}
+	}
+
+	c.log().Infof("cherry-picked onto %s as #%d", branch, newPR.GetNumber())
+	return b.comment(ctx, c, fmt.Sprintf("@%s: cherry-picked onto `%s` in #%d.", c.user, branch, newPR.GetNumber()))
+}
+
+// cherryPickPR returns the open pullrequest of head, opening one if there's
+// none, so that a retried command doesn't open another
+func (b *Bot) cherryPickPR(ctx context.Context, c *command, pr *github.PullRequest, head, branch string) (*github.PullRequest, error) {
+	open, err := b.openPullRequests(ctx, c.owner, c.repo, head, branch)
+	if err != nil {
+		return nil, err
+	}
+	if len(open) > 0 {
+		return open[0], nil
+	}
+	body := fmt.Sprintf("Cherry-pick of #%d onto `%s`, requested by @%s.", c.number, branch, c.user)
+	if len(pr.GetBody()) > 0 {
+		body += "\n\n" + pr.GetBody()
+	}
+	return b.createPullRequest(ctx, c, &github.NewPullRequest{
+		Title: github.String(fmt.Sprintf("[%s] %s", branch, pr.GetTitle())),
+		Head:  github.String(head),
+		Base:  github.String(branch),
+		Body:  github.String(body),
+	})
+}
+
+// openPullRequests returns open pullrequests of branch head of the repo
+// onto branch base
+func (b *Bot) openPullRequests(ctx context.Context, owner, repo, head, base string) ([]*github.PullRequest, error) {
+	open, _, err := b.git.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{
+		State: "open",
+		Head:  owner + ":" + head,
+		Base:  base,
+	})
+	return open, err
+}
+
+// cherryPickConflict tells how to cherry-pick by hand
+func cherryPickConflict(c *command, branch string, commits []*github.RepositoryCommit, conflicts []string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "@%s: this PR can't be cherry-picked onto `%s` automatically, these files conflict:\n\n", c.user, branch)
+	for _, f := range conflicts {
+		fmt.Fprintf(&buf, "- `%s`\n", f)
+	}
+	fmt.Fprintf(&buf, "\nTo cherry-pick it by hand:\n\n```sh\n")
+	fmt.Fprintf(&buf, "git fetch origin %s pull/%d/head\n", branch, c.number)
+	fmt.Fprintf(&buf, "git checkout -b cherry-pick-%d-to-%s origin/%s\n", c.number, branch, branch)
+	fmt.Fprintf(&buf, "git cherry-pick -x")
+	for _, rc := range commits {
+		fmt.Fprintf(&buf, " %s", rc.GetSHA())
+	}
+	fmt.Fprintf(&buf, "\n# resolve conflicts, git cherry-pick --continue, then push and open a PR against %s\n```\n", branch)
+	return buf.String()
+}
+
+// prCommits returns commits of a pullrequest, oldest first
+func (b *Bot) prCommits(ctx context.Context, owner, repo string, number int) ([]*github.RepositoryCommit, error) {
+	var commits []*github.RepositoryCommit
+	opt := &github.ListOptions{Page: 1, PerPage: 100}
+	for opt.Page > 0 {
+		list, resp, err := b.git.PullRequests.ListCommits(ctx, owner, repo, number, opt)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, list...)
+		opt.Page = resp.NextPage
+	}
+	return commits, nil
+}
+
+// commitPaths returns paths of files changed by commit sha, both paths of
+// a renamed file. The vendored client lacks the previous name of a file.
+func (b *Bot) commitPaths(ctx context.Context, owner, repo, sha string) ([]string, error) {
+	var paths []string
+	page := 1
+	for page > 0 {
+		u := fmt.Sprintf("repos/%v/%v/commits/%v?page=%d&per_page=100", owner, repo, sha, page)
+		req, err := b.git.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		commit := new(struct {
+			Files []struct {
+				Filename         string `json:"filename"`
+				PreviousFilename string `json:"previous_filename"`
+			} `json:"files"`
+		})
+		resp, err := b.git.Do(ctx, req, commit)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range commit.Files {
+			paths = append(paths, f.Filename)
+			if len(f.PreviousFilename) > 0 {
+				paths = append(paths, f.PreviousFilename)
+			}
+		}
+		page = resp.NextPage
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// treeCache looks up files of trees directory by directory, so that only
+// directories on the way to changed files are fetched. Trees are cached by
+// sha, which is shared by the unchanged directories of different commits.
+type treeCache struct {
+	bot         *Bot
+	owner, repo string
+	trees       map[string]*github.Tree
+}
+
+// entry returns the file (blob, symlink or submodule) at path of the tree
+// of sha, a commit or a tree, or nil if there's none
+func (t *treeCache) entry(ctx context.Context, sha, path string) (*github.TreeEntry, error) {
+	names := strings.Split(path, "/")
+	for i, name := range names {
+		tree, err := t.tree(ctx, sha)
+		if err != nil {
+			return nil, err
+		}
+		var found *github.TreeEntry
+		for j := range tree.Entries {
+			if tree.Entries[j].GetPath() == name {
+				found = &tree.Entries[j]
+				break
+			}
+		}
+		switch {
+		case found == nil:
+			return nil, nil
+		case i == len(names)-1:
+			if found.GetType() == "tree" {
+				return nil, nil
+			}
+			return found, nil
+		case found.GetType() != "tree":
+			return nil, nil
+		}
+		sha = found.GetSHA()
+	}
+	return nil, nil
+}
+
+// tree returns the (not recursive) tree of sha
+func (t *treeCache) tree(ctx context.Context, sha string) (*github.Tree, error) {
+	if tree, ok := t.trees[sha]; ok {
+		return tree, nil
+	}
+	tree, _, err := t.bot.git.Git.GetTree(ctx, t.owner, t.repo, sha, false)
+	if err != nil {
+		return nil, err
+	}
+	if tree.GetTruncated() {
+		return nil, permanent(fmt.Errorf("tree %s is too large to be listed", sha))
+	}
+	t.trees[sha] = tree
+	return tree, nil
+}
+
+// sameEntry returns whether two tree entries have the same content and mode,
+// nil being a missing file
+func sameEntry(a, b *github.TreeEntry) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.GetSHA() == b.GetSHA() && a.GetMode() == b.GetMode()
+}
+
+// treeChange is a file of a new tree. TreeEntry omits an empty sha, while
+// a file is deleted from the base tree by a null one.
+type treeChange struct {
+	Path string  `json:"path"`
+	Mode string  `json:"mode"`
+	Type string  `json:"type"`
+	SHA  *string `json:"sha"`
+}
+
+// newTreeChange changes path to entry to, or deletes it (from) if to is nil
+func newTreeChange(path string, to, from *github.TreeEntry) treeChange {
+	if to == nil {
+		return treeChange{Path: path, Mode: from.GetMode(), Type: from.GetType()}
+	}
+	return treeChange{Path: path, Mode: to.GetMode(), Type: to.GetType(), SHA: to.SHA}
+}
@@ -0,0 +1,198 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/dastanng/gitbot/pkg/bot/queue"
+)
+
+func treeEntry(path, typ, sha string) map[string]string {
+	mode := "100644"
+	if typ == "tree" {
+		mode = "040000"
+	}
+	return map[string]string{"path": path, "type": typ, "sha": sha, "mode": mode}
+}
+
+func gitTree(sha string, entries ...map[string]string) map[string]interface{} {
+	return map[string]interface{}{"sha": sha, "tree": entries}
+}
+
+// cherryPickTrees are trees of commit c1 changing a.go and pkg/b.go,
+// parent p, onto which branch is cherry-picked
+var cherryPickTrees = map[string]interface{}{
+	"GET /repos/o/r/git/trees/p":    gitTree("p", treeEntry("a.go", "blob", "a1"), treeEntry("pkg", "tree", "pkg1")),
+	"GET /repos/o/r/git/trees/pkg1": gitTree("pkg1", treeEntry("b.go", "blob", "b1")),
+	"GET /repos/o/r/git/trees/t1":   gitTree("t1", treeEntry("a.go", "blob", "a2"), treeEntry("pkg", "tree", "pkg2")),
+	"GET /repos/o/r/git/trees/pkg2": gitTree("pkg2", treeEntry("b.go", "blob", "b2")),
+}
+
+func TestTreeCacheEntry(t *testing.T) {
+	b, gh, close := newTestBot(t, cherryPickTrees)
+	defer close()
+	trees := &treeCache{bot: b, owner: "o", repo: "r", trees: make(map[string]*github.Tree)}
+
+	tests := []struct {
+		path string
+		want string // sha, empty if there's no file
+	}{
+		{"a.go", "a1"},
+		{"pkg/b.go", "b1"},
+		{"pkg", ""},
+		{"pkg/c.go", ""},
+		{"a.go/x", ""},
+		{"missing/b.go", ""},
+	}
+	for _, test := range tests {
+		e, err := trees.entry(context.Background(), "p", test.path)
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+		if got := e.GetSHA(); got != test.want {
+			t.Errorf("entry(%s) = %q, want %q", test.path, got, test.want)
+		}
+	}
+
+	n := 0
+	for _, call := range gh.calls {
+		if call == "GET /repos/o/r/git/trees/pkg1" {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("tree pkg1 fetched %d times, want once", n)
+	}
+}
+
+func TestCherryPick(t *testing.T) {
+	commit := func(sha string, parents ...string) map[string]interface{} {
+		var ps []map[string]string
+		for _, p := range parents {
+			ps = append(ps, map[string]string{"sha": p})
+		}
+		return map[string]interface{}{
+			"sha":     sha,
+			"parents": ps,
+			"commit":  map[string]interface{}{"message": "fix", "tree": map[string]string{"sha": "t1"}},
+		}
+	}
+	tests := []struct {
+		name    string
+		commits []map[string]interface{}
+		base    map[string]interface{} // tree of branch
+		want    []string               // audited actions
+		comment string                 // part of the comment
+	}{
+		{
+			name:    "clean",
+			commits: []map[string]interface{}{commit("c1", "p")},
+			base:    gitTree("tb", treeEntry("a.go", "blob", "a1"), treeEntry("pkg", "tree", "pkg1")),
+			want:    []string{"Git.CreateTree", "Git.CreateCommit", "Git.CreateRef", "PullRequests.Create", "Issues.CreateComment"},
+			comment: "cherry-picked onto `release` in #2",
+		},
+		{
+			name:    "conflict",
+			commits: []map[string]interface{}{commit("c1", "p")},
+			base:    gitTree("tb", treeEntry("a.go", "blob", "ax"), treeEntry("pkg", "tree", "pkg1")),
+			want:    []string{"Issues.CreateComment"},
+			comment: "these files conflict:\n\n- `a.go`\n\n",
+		},
+		{
+			name:    "deleted on branch",
+			commits: []map[string]interface{}{commit("c1", "p")},
+			base:    gitTree("tb", treeEntry("a.go", "blob", "a1")),
+			want:    []string{"Issues.CreateComment"},
+			comment: "these files conflict:\n\n- `pkg/b.go`\n\n",
+		},
+		{
+			name:    "on branch already",
+			commits: []map[string]interface{}{commit("c1", "p")},
+			base:    gitTree("tb", treeEntry("a.go", "blob", "a2"), treeEntry("pkg", "tree", "pkg2")),
+			want:    []string{"Issues.CreateComment"},
+			comment: "nothing to cherry-pick",
+		},
+		{
+			name:    "merge commit",
+			commits: []map[string]interface{}{commit("c1", "p"), commit("m1", "c1", "p")},
+			want:    []string{"Issues.CreateComment"},
+			comment: "merge commit m1",
+		},
+	}
+	for _, test := range tests {
+		var comment string
+		routes := map[string]interface{}{
+			"GET /repos/o/r/pulls/1/commits": test.commits,
+			"GET /repos/o/r/git/refs/heads/release": map[string]interface{}{
+				"ref": "refs/heads/release", "object": map[string]string{"sha": "h"},
+			},
+			"GET /repos/o/r/git/commits/h": map[string]interface{}{"sha": "h", "tree": map[string]string{"sha": "tb"}},
+			"GET /repos/o/r/git/trees/tb":  test.base,
+			"GET /repos/o/r/commits/c1":    map[string]interface{}{"files": []map[string]string{{"filename": "a.go"}, {"filename": "pkg/b.go"}}},
+			"POST /repos/o/r/git/trees":    map[string]string{"sha": "nt"},
+			"POST /repos/o/r/git/commits":  map[string]string{"sha": "nc"},
+			"POST /repos/o/r/git/refs":     map[string]string{"ref": "refs/heads/cherry-pick-1-to-release"},
+			"GET /repos/o/r/pulls":         []interface{}{},
+			"POST /repos/o/r/pulls":        map[string]interface{}{"number": 2},
+			"POST /repos/o/r/issues/1/comments": func(r *http.Request) (int, interface{}) {
+				var c github.IssueComment
+				json.NewDecoder(r.Body).Decode(&c)
+				comment = c.GetBody()
+				return http.StatusCreated, &c
+			},
+		}
+		for k, v := range cherryPickTrees {
+			routes[k] = v
+		}
+		b, gh, close := newTestBot(t, routes)
+
+		c := &command{owner: "o", repo: "r", number: 1, user: "alice", cmd: "/cherry-pick", args: []string{"release"}}
+		if err := b.cherryPick(context.Background(), c, &github.PullRequest{Title: github.String("Fix")}, "release"); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if got := auditActions(t, b); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got actions %v, want %v", test.name, got, test.want)
+		}
+		if !strings.Contains(comment, test.comment) {
+			t.Errorf("%s: got comment %q, want it to contain %q", test.name, comment, test.comment)
+		}
+		if test.base == nil && gh.called("GET /repos/o/r/git/trees/p") {
+			t.Errorf("%s: trees looked up", test.name)
+		}
+		close()
+	}
+}
+
+func TestCherryPickMergedBranches(t *testing.T) {
+	b, _, close := newTestBot(t, map[string]interface{}{
+		"GET /repos/o/r/issues/1/comments": []map[string]interface{}{
+			{"body": "/cherry-pick release-1.0\n/cherry-pick Release-1.0", "user": map[string]string{"login": "bob"}},
+			{"body": "/cherry-pick release-1.0", "user": map[string]string{"login": "carol"}},
+		},
+	})
+	defer close()
+	b.queue = queue.NewFairQueue(10, b.tenantOf, workqueue.DefaultControllerRateLimiter())
+
+	pr := &github.PullRequest{Merged: github.Bool(true), Body: github.String("/cherry-pick release-1.1\n/cherry-pick")}
+	c := &command{owner: "o", repo: "r", number: 1, author: "alice", cmd: cherryPickMerged, event: &github.PullRequestEvent{PullRequest: pr}}
+	if err := b.cmdCherryPickMerged(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for b.queue.Len() > 0 {
+		item, _ := b.queue.Get()
+		cmd := item.(*command)
+		got = append(got, cmd.user+" "+cmd.args[0])
+		b.queue.Done(item)
+	}
+	if want := []string{"alice release-1.1", "bob release-1.0", "bob Release-1.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -3,9 +3,9 @@ package bot
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
 
-	"github.com/golang/glog"
 	"github.com/google/go-github/github"
 
 	"github.com/dastanng/gitbot/pkg/bot/labels"
@@ -22,27 +22,49 @@ type command struct {
 
 	cmd  string   // command name
 	args []string // command arguments. optional
+	raw  string   // line of the comment carrying the command, as written
+	url  string   // html url of the comment carrying the command
+	key  string   // identifies the command within its comment, see seenCache
 
-	event interface{} // github event
+	// pending are commands spawned by this one which didn't fit in the
+	// queue yet, see fanOut
+	pending []*command
+
+	event     interface{} // github event
+	eventType string      // github event type, e.g. issue_comment
+	delivery  string      // github delivery id of the webhook request
 }
 
-func (c *command) succeed() string {
-	return fmt.Sprintf("%s - succeed!", c.info())
+// log returns a logger carrying the command context, so that a comment
+// can be traced from webhook delivery to handler.
+func (c *command) log() *logger {
+	return log.with("delivery", c.delivery).
+		with("event", c.eventType).
+		with("owner", c.owner).
+		with("repo", c.repo).
+		with("number", c.number).
+		with("author", c.author).
+		with("user", c.user).
+		with("command", c.cmd).
+		with("args", strings.Join(c.args, " "))
 }
 
-func (c *command) invalid() string {
-	return fmt.Sprintf("%s - invalid!", c.info())
+// line returns the command as written, e.g. /kind bug
+func (c *command) line() string {
+	if len(c.args) == 0 {
+		return c.cmd
+	}
+	return c.cmd + " " + strings.Join(c.args, " ")
 }
 
-func (c *command) failed() string {
-	return fmt.Sprintf("%s - failed!", c.info())
+// invalid reports bad command syntax
+func (c *command) invalid() error {
+	return &skippedError{outcome: "invalid", reason: "invalid command syntax"}
 }
 
-func (c *command) info() string {
-	return fmt.Sprintf("[%s/%s #%d(%s)] %s: %s %s",
-		c.owner, c.repo, c.number, c.author,
-		c.user, c.cmd, strings.Join(c.args, " "),
-	)
+// ignore reports a command which is not run, e.g. the user lacks permission
+func (c *command) ignore(format string, args ...interface{}) error {
+	return &skippedError{outcome: "ignored", reason: fmt.Sprintf(format, args...)}
 }
 
 // argsToUsers parses user list from command args
@@ -60,55 +82,96 @@ func (c *command) argsToUsers() []string {
 	return users
 }
 
-// cmdClose handles command /close
-func (b *Bot) cmdClose(c *command) bool {
+// cmdClose handles command /close and /reopen
+func (b *Bot) cmdClose(ctx context.Context, c *command) error {
 	// check command syntax
 	if len(c.args) != 0 {
-		glog.Info(c.invalid())
-		return true
+		return c.invalid()
 	}
 
-	ctx := context.Background()
-
-	// close command can only be used by authors or collaborators
+	// close (reopen) command can only be used by authors or collaborators
 	if c.user != c.author {
 		isCollab, _, err := b.git.Repositories.IsCollaborator(ctx, c.owner, c.repo, c.user)
 		if err != nil {
-			glog.Errorf("%s err: %v", c.failed(), err)
-			return false
+			return err
 		}
 		if !isCollab {
-			glog.Infof("%s user is neither author nor a collaborator, ignore.", c.failed())
-			return true
+			return c.ignore("user is neither author nor a collaborator")
 		}
 	}
 
-	// close issue as user requested
-	state := new(string)
-	*state = "closed"
-	if _, _, err := b.git.Issues.Edit(ctx, c.owner, c.repo, c.number, &github.IssueRequest{State: state}); err != nil {
-		glog.Errorf("%s err: %v", c.failed(), err)
-		return false
+	// close (reopen) issue as user requested
+	state := "closed"
+	if c.cmd == "/reopen" {
+		state = "open"
 	}
-	glog.Info(c.succeed())
-	return true
+	if err := b.editState(ctx, c, state); err != nil {
+		return err
+	}
+	return nil
+}
+
+// cmdRetitle handles command /retitle <title>
+func (b *Bot) cmdRetitle(ctx context.Context, c *command) error {
+	// check command syntax, the title may be quoted or not
+	title := strings.TrimSpace(strings.Join(c.args, " "))
+	if len(title) == 0 {
+		return c.invalid()
+	}
+
+	// retitle command can only be used by authors or collaborators
+	allowed, err := b.hasRole(ctx, c, []string{roleAuthor, roleCollaborator})
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return c.ignore("user is neither author nor a collaborator")
+	}
+
+	return b.editTitle(ctx, c, title)
+}
+
+// lock reasons accepted by GitHub
+var lockReasons = []string{"off-topic", "too heated", "resolved", "spam"}
+
+// cmdLock handles command /lock [reason] and /unlock
+func (b *Bot) cmdLock(ctx context.Context, c *command) error {
+	// check command syntax, reason "too heated" has two words
+	reason := strings.ToLower(strings.Join(c.args, " "))
+	if c.cmd == "/unlock" && len(reason) > 0 {
+		return c.invalid()
+	}
+	if len(reason) > 0 && !containsFold(lockReasons, reason) {
+		return c.invalid()
+	}
+
+	// lock command can only be used by maintainers
+	isMaintainer, err := b.isMaintainer(ctx, c.owner, c.repo, c.user)
+	if err != nil {
+		return err
+	}
+	if !isMaintainer {
+		return c.ignore("user %s is not a maintainer", c.user)
+	}
+
+	if c.cmd == "/unlock" {
+		return b.unlock(ctx, c)
+	}
+	return b.lock(ctx, c, reason)
 }
 
 // cmdAssign handles command /[un]assign [[@]...]
-func (b *Bot) cmdAssign(c *command) bool {
+func (b *Bot) cmdAssign(ctx context.Context, c *command) error {
 	// check command syntax
 	if len(c.args) > 1 {
-		glog.Info(c.invalid())
-		return true
+		return c.invalid()
 	}
 
 	// ignore assign command when repo owner is not an organization
 	if c.ownerType != "Organization" {
-		glog.Infof("repo owner is not an organization, ignore.")
-		return true
+		return c.ignore("repo owner is not an organization")
 	}
 
-	ctx := context.Background()
 	assignee := c.user
 	if len(c.args) == 1 {
 		assignee = strings.TrimPrefix(c.args[0], "@")
@@ -119,23 +182,19 @@ func (b *Bot) cmdAssign(c *command) bool {
 	// assign/unassign issue to/from assignee as requested.
 	var err error
 	if c.cmd == "/assign" {
-		_, _, err = b.git.Issues.AddAssignees(ctx, c.owner, c.repo, c.number, []string{assignee})
+		err = b.addAssignees(ctx, c, []string{assignee})
 	} else { // /unassign
-		_, _, err = b.git.Issues.RemoveAssignees(ctx, c.owner, c.repo, c.number, []string{assignee})
+		err = b.removeAssignees(ctx, c, []string{assignee})
 	}
 	if err != nil {
-		glog.Errorf("%s err: %v", c.failed(), err)
-		return false
+		return err
 	}
-	glog.Info(c.succeed())
-	return true
+	return nil
 }
 
 // cmdCc handles command /[un]cc [[@]...]
-func (b *Bot) cmdCc(c *command) bool {
+func (b *Bot) cmdCc(ctx context.Context, c *command) error {
 	var err error
-	ctx := context.Background()
-
 	var validUsers []string
 	for _, usr := range c.argsToUsers() {
 		// author is not allowed to be a reviewer
@@ -143,10 +202,9 @@ func (b *Bot) cmdCc(c *command) bool {
 			continue
 		}
 		// validates if user is a 'member' or 'collaborator' of owner/repo
-		isMember, err := b.isMember(c.owner, c.repo, usr)
+		isMember, err := b.isMember(ctx, c.owner, c.repo, usr)
 		if err != nil {
-			glog.Errorf("%s err: %v", c.failed(), err)
-			return false
+			return err
 		}
 		if isMember {
 			validUsers = append(validUsers, usr)
@@ -154,29 +212,24 @@ func (b *Bot) cmdCc(c *command) bool {
 	}
 
 	if len(validUsers) == 0 {
-		return true
+		return nil
 	}
 
-	reviewersRequest := github.ReviewersRequest{Reviewers: validUsers}
 	if c.cmd == "/cc" {
-		_, _, err = b.git.PullRequests.RequestReviewers(ctx, c.owner, c.repo, c.number, reviewersRequest)
+		err = b.requestReviewers(ctx, c, validUsers)
 	} else { // /uncc
-		_, err = b.git.PullRequests.RemoveReviewers(ctx, c.owner, c.repo, c.number, reviewersRequest)
+		err = b.removeReviewers(ctx, c, validUsers)
 	}
 
 	if err != nil {
-		glog.Errorf("%s err: %v", c.failed(), err)
-		return false
+		return err
 	}
 
-	glog.Info(c.succeed())
-	return true
+	return nil
 }
 
 // isMember validates if user is a 'member' or 'collaborator' of owner/repo
-func (b *Bot) isMember(owner, repo, user string) (bool, error) {
-	ctx := context.Background()
-
+func (b *Bot) isMember(ctx context.Context, owner, repo, user string) (bool, error) {
 	// make sure user is a member of an organization
 	isMember, _, err := b.git.Organizations.IsMember(ctx, owner, user)
 	if err != nil {
@@ -197,131 +250,229 @@ func (b *Bot) isMember(owner, repo, user string) (bool, error) {
 }
 
 // cmdHold handles command /hold [cancel]
-func (b *Bot) cmdHold(c *command) bool {
+func (b *Bot) cmdHold(ctx context.Context, c *command) error {
 	var err error
-	ctx := context.Background()
-
 	// check command syntax
 	if len(c.args) > 1 {
-		glog.Info(c.invalid())
-		return true
+		return c.invalid()
 	}
 
 	var isCancel bool
 	if len(c.args) == 1 {
 		if c.args[0] != "cancel" {
-			glog.Info(c.invalid())
-			return true
+			return c.invalid()
 		}
 		isCancel = true
 	}
 
 	if !isCancel { // /hold
-		_, _, err = b.git.Issues.AddLabelsToIssue(ctx, c.owner, c.repo, c.number, []string{labels.Hold})
+		err = b.addLabels(ctx, c, labels.Hold)
 	} else { // /hold cancel
-		_, err = b.git.Issues.RemoveLabelForIssue(ctx, c.owner, c.repo, c.number, labels.Hold)
+		err = b.removeLabel(ctx, c, labels.Hold)
 	}
 
 	if err != nil {
-		glog.Errorf("%s err: %v", c.failed(), err)
-		return false
+		return err
 	}
 
-	glog.Info(c.succeed())
-	return true
+	return nil
 }
 
 // cmdWip handles command /wip [cancel]
-func (b *Bot) cmdWip(c *command) bool {
+func (b *Bot) cmdWip(ctx context.Context, c *command) error {
 	var err error
-	ctx := context.Background()
-
 	// check command syntax
 	if len(c.args) > 1 {
-		glog.Info(c.invalid())
-		return true
+		return c.invalid()
 	}
 
 	var isCancel bool
 	if len(c.args) == 1 {
 		if c.args[0] != "cancel" {
-			glog.Info(c.invalid())
-			return true
+			return c.invalid()
 		}
 		isCancel = true
 	}
 
 	if !isCancel { // /wip
-		_, _, err = b.git.Issues.AddLabelsToIssue(ctx, c.owner, c.repo, c.number, []string{labels.WorkInProgress})
+		err = b.addLabels(ctx, c, labels.WorkInProgress)
 	} else { // /wip cancel
-		_, err = b.git.Issues.RemoveLabelForIssue(ctx, c.owner, c.repo, c.number, labels.WorkInProgress)
+		err = b.removeLabel(ctx, c, labels.WorkInProgress)
 	}
 
 	if err != nil {
-		glog.Errorf("%s err: %v", c.failed(), err)
-		return false
+		return err
 	}
 
-	glog.Info(c.succeed())
-	return true
+	return nil
 }
 
-// cmdLabel handles command /[remove-](kind|area|task)
-func (b *Bot) cmdLabel(c *command) bool {
-	var err error
-	ctx := context.Background()
+// roles of users allowed to use a command
+const (
+	roleAuthor       = "author"
+	roleMember       = "member"
+	roleCollaborator = "collaborator"
+	roleMaintainer   = "maintainer"
+)
 
+// cmdLabel handles command /[remove-]<category> <value>..., where
+// categories are configured, e.g. /kind bug regression
+func (b *Bot) cmdLabel(ctx context.Context, c *command) error {
 	// check command syntax
-	if len(c.args) != 1 {
-		glog.Info(c.invalid())
-		return true
+	if len(c.args) == 0 {
+		return c.invalid()
 	}
 
-	if len(c.args[0]) == 0 {
-		glog.Info(c.invalid())
-		return true
+	// remove command type prefix '/' and 'remove-'
+	name := strings.TrimPrefix(c.cmd[1:], "remove-")
+	isRemove := len(name) != len(c.cmd[1:])
+	category := b.cfg.LabelCategory(name, c.owner, c.repo)
+	if category == nil {
+		return c.ignore("label category %s is not enabled", name)
+	}
+	if category.Exclusive && !isRemove && len(c.args) > 1 {
+		return c.invalid()
 	}
 
-	// user should add / remove label from available repo labels
-	recognizedLabels, err := b.getRepoLabels(c.owner, c.repo)
+	allowed, err := b.hasRole(ctx, c, category.Roles)
 	if err != nil {
-		glog.Errorf("%s err: %v", c.failed(), err)
-		return false
+		return err
+	}
+	if !allowed {
+		return c.ignore("user %s is not %s", c.user, strings.Join(category.Roles, " or "))
 	}
 
-	// remove command type prefix '/' and 'remove-'
-	cmdSuffix := strings.TrimPrefix(c.cmd[1:], "remove-")
-
+	// user should add / remove label from available repo labels,
 	// do not add new label from cmd args
-	cmdLabel := strings.ToLower(fmt.Sprintf("%s/%s", cmdSuffix, c.args[0]))
-	if _, ok := recognizedLabels[cmdLabel]; !ok {
-		return true
+	names := make([]string, 0, len(c.args))
+	for _, arg := range c.args {
+		names = append(names, strings.ToLower(fmt.Sprintf("%s/%s", name, arg)))
 	}
-
-	isRemove := false
-	if len(cmdSuffix) != len(strings.TrimPrefix(c.cmd, "/")) {
-		isRemove = true
+	known, unknown, err := b.recognizedLabels(ctx, c.owner, c.repo, names...)
+	if err != nil {
+		return err
+	}
+	if len(known) == 0 {
+		return c.ignore("label %s is not recognized", strings.Join(unknown, ", "))
+	}
+	if len(unknown) > 0 {
+		c.log().Warningf("label %s is not recognized, skipped", strings.Join(unknown, ", "))
 	}
 
+	current, err := b.issueLabels(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
 	if isRemove {
-		_, err = b.git.Issues.RemoveLabelForIssue(ctx, c.owner, c.repo, c.number, cmdLabel)
-	} else {
-		_, _, err = b.git.Issues.AddLabelsToIssue(ctx, c.owner, c.repo, c.number, []string{cmdLabel})
+		for _, l := range known {
+			if !containsFold(current, l) {
+				continue
+			}
+			if err := b.removeLabel(ctx, c, l); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if category.Exclusive {
+		// one label of the category at a time
+		for _, l := range current {
+			if strings.HasPrefix(strings.ToLower(l), strings.ToLower(name)+"/") && !strings.EqualFold(l, known[0]) {
+				if err := b.removeLabel(ctx, c, l); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return b.addLabels(ctx, c, known...)
+}
+
+// hasRole returns whether the user of c has one of roles, true if roles
+// is empty. Roles are author, member (of the org), collaborator (of
+// the repo) and maintainer.
+func (b *Bot) hasRole(ctx context.Context, c *command, roles []string) (bool, error) {
+	if len(roles) == 0 {
+		return true, nil
+	}
+	for _, role := range roles {
+		var ok bool
+		var err error
+		switch strings.ToLower(role) {
+		case roleAuthor:
+			ok = strings.EqualFold(c.user, c.author)
+		case roleMember:
+			ok, _, err = b.git.Organizations.IsMember(ctx, c.owner, c.user)
+		case roleCollaborator:
+			ok, _, err = b.git.Repositories.IsCollaborator(ctx, c.owner, c.repo, c.user)
+		case roleMaintainer:
+			ok, err = b.isMaintainer(ctx, c.owner, c.repo, c.user)
+		}
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isMaintainer returns whether user is an active member of the
+// maintainers team of owner/repo
+func (b *Bot) isMaintainer(ctx context.Context, owner, repo, user string) (bool, error) {
+	m := b.cfg.MaintainersOf(owner, repo)
+	if m == nil {
+		return false, nil
 	}
 
+	// the team is looked up by slug, which the vendored client can't do
+	req, err := b.git.NewRequest("GET", fmt.Sprintf("orgs/%v/teams/%v/memberships/%v", owner, m.Team, user), nil)
 	if err != nil {
-		glog.Errorf("%s err: %v", c.failed(), err)
-		return false
+		return false, err
+	}
+	membership := new(github.Membership)
+	resp, err := b.git.Do(ctx, req, membership)
+	if err == nil {
+		return membership.GetState() == "active", nil
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return false, err
+	}
+
+	// not a member, unless the team itself is missing
+	req, err = b.git.NewRequest("GET", fmt.Sprintf("orgs/%v/teams/%v", owner, m.Team), nil)
+	if err != nil {
+		return false, err
+	}
+	if resp, err := b.git.Do(ctx, req, nil); err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, permanent(fmt.Errorf("maintainers team %s not found in %s", m.Team, owner))
+		}
+		return false, err
 	}
+	return false, nil
+}
 
-	glog.Info(c.succeed())
-	return true
+// recognizedLabels splits names into labels existing in repo, with their
+// name in repo, and unknown ones. Labels are matched case-insensitively.
+func (b *Bot) recognizedLabels(ctx context.Context, owner, repo string, names ...string) (known, unknown []string, err error) {
+	repoLabels, err := b.getRepoLabels(ctx, owner, repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, n := range names {
+		if l, ok := repoLabels[strings.ToLower(n)]; ok {
+			known = append(known, l.GetName())
+		} else {
+			unknown = append(unknown, n)
+		}
+	}
+	return known, unknown, nil
 }
 
 // getRepoLabels returns labels from repo
-func (b *Bot) getRepoLabels(owner, repo string) (map[string]*github.Label, error) {
-	ctx := context.Background()
-
+func (b *Bot) getRepoLabels(ctx context.Context, owner, repo string) (map[string]*github.Label, error) {
 	lables := make(map[string]*github.Label)
 	opt := &github.ListOptions{Page: 1, PerPage: 100}
 	for opt.Page > 0 {
@@ -339,48 +490,40 @@ func (b *Bot) getRepoLabels(owner, repo string) (map[string]*github.Label, error
 }
 
 // cmdLgtm handles command /lgtm [cancel]
-func (b *Bot) cmdLgtm(c *command) bool {
+func (b *Bot) cmdLgtm(ctx context.Context, c *command) error {
 	var err error
-	ctx := context.Background()
-
 	// check command syntax
 	if len(c.args) > 1 {
-		glog.Info(c.invalid())
-		return true
+		return c.invalid()
 	}
 
 	// validates if user is a 'member' or 'collaborator' of owner/repo
-	isMember, err := b.isMember(c.owner, c.repo, c.user)
+	isMember, err := b.isMember(ctx, c.owner, c.repo, c.user)
 	if err != nil {
-		glog.Errorf("%s err: %v", c.failed(), err)
-		return false
+		return err
 	}
 
 	if !isMember {
-		glog.Infof("user %s is not a member or collaborator of %s/%s, ignore.", c.user, c.owner, c.repo)
-		return true
+		return c.ignore("user %s is not a member or collaborator of %s/%s", c.user, c.owner, c.repo)
 	}
 
 	var isCancel bool
 	if len(c.args) == 1 {
 		if c.args[0] != "cancel" {
-			glog.Info(c.invalid())
-			return true
+			return c.invalid()
 		}
 		isCancel = true
 	}
 
 	if !isCancel { // /lgtm
-		_, _, err = b.git.Issues.AddLabelsToIssue(ctx, c.owner, c.repo, c.number, []string{labels.LGTM})
+		err = b.addLabels(ctx, c, labels.LGTM)
 	} else { // /lgtm cancel
-		_, err = b.git.Issues.RemoveLabelForIssue(ctx, c.owner, c.repo, c.number, labels.LGTM)
+		err = b.removeLabel(ctx, c, labels.LGTM)
 	}
 
 	if err != nil {
-		glog.Errorf("%s err: %v", c.failed(), err)
-		return false
+		return err
 	}
 
-	glog.Info(c.succeed())
-	return true
+	return nil
 }
@@ -0,0 +1,156 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/config"
+)
+
+// roleRoutes answer collaborator and maintainer checks: collab is a
+// collaborator of o/r, maint an active member of its maintainers team
+var roleRoutes = map[string]interface{}{
+	"GET /repos/o/r/collaborators/collab":          nil,
+	"GET /orgs/o/teams/maint/memberships/maint":    map[string]string{"state": "active"},
+	"GET /orgs/o/teams/maint/memberships/inactive": map[string]string{"state": "pending"},
+	"GET /orgs/o/teams/maint":                      map[string]string{"slug": "maint"},
+}
+
+func withRoutes(routes map[string]interface{}) map[string]interface{} {
+	all := make(map[string]interface{})
+	for k, v := range roleRoutes {
+		all[k] = v
+	}
+	for k, v := range routes {
+		all[k] = v
+	}
+	return all
+}
+
+func TestClose(t *testing.T) {
+	tests := []struct {
+		name  string
+		cmd   string
+		args  []string
+		user  string
+		err   error
+		state string // requested state
+	}{
+		{name: "author", cmd: "/close", user: "author", state: "closed"},
+		{name: "collaborator", cmd: "/reopen", user: "collab", state: "open"},
+		{name: "other", cmd: "/close", user: "other", err: &skippedError{outcome: "ignored", reason: "user is neither author nor a collaborator"}},
+		{name: "args", cmd: "/close", args: []string{"now"}, user: "author", err: &skippedError{outcome: "invalid", reason: "invalid command syntax"}},
+	}
+	for _, test := range tests {
+		var state string
+		b, _, close := newTestBot(t, withRoutes(map[string]interface{}{
+			"GET /repos/o/r/issues/1": &github.Issue{State: github.String("open")},
+			"PATCH /repos/o/r/issues/1": func(r *http.Request) (int, interface{}) {
+				var req github.IssueRequest
+				json.NewDecoder(r.Body).Decode(&req)
+				state = req.GetState()
+				return http.StatusOK, &github.Issue{}
+			},
+		}))
+		c := &command{owner: "o", repo: "r", number: 1, author: "author", user: test.user, cmd: test.cmd, args: test.args}
+		if err := b.cmdClose(context.Background(), c); !reflect.DeepEqual(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+		if state != test.state {
+			t.Errorf("%s: got state %q, want %q", test.name, state, test.state)
+		}
+		close()
+	}
+}
+
+func TestRetitle(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		user  string
+		err   error
+		title string // requested title
+	}{
+		{name: "author", args: []string{"Fix", "`nil`", "deref"}, user: "author", title: "Fix `nil` deref"},
+		{name: "quoted", args: []string{"a new title"}, user: "collab", title: "a new title"},
+		{name: "empty", args: []string{" "}, user: "author", err: &skippedError{outcome: "invalid", reason: "invalid command syntax"}},
+		{name: "other", args: []string{"title"}, user: "other", err: &skippedError{outcome: "ignored", reason: "user is neither author nor a collaborator"}},
+	}
+	for _, test := range tests {
+		var title string
+		b, _, close := newTestBot(t, withRoutes(map[string]interface{}{
+			"GET /repos/o/r/issues/1": &github.Issue{Title: github.String("old")},
+			"PATCH /repos/o/r/issues/1": func(r *http.Request) (int, interface{}) {
+				var req github.IssueRequest
+				json.NewDecoder(r.Body).Decode(&req)
+				title = req.GetTitle()
+				return http.StatusOK, &github.Issue{}
+			},
+		}))
+		c := &command{owner: "o", repo: "r", number: 1, author: "author", user: test.user, cmd: "/retitle", args: test.args}
+		if err := b.cmdRetitle(context.Background(), c); !reflect.DeepEqual(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+		if title != test.title {
+			t.Errorf("%s: got title %q, want %q", test.name, title, test.title)
+		}
+		close()
+	}
+}
+
+func TestLock(t *testing.T) {
+	invalid := &skippedError{outcome: "invalid", reason: "invalid command syntax"}
+	tests := []struct {
+		name   string
+		cmd    string
+		args   []string
+		user   string
+		err    error
+		action string
+		reason string // requested lock reason
+	}{
+		{name: "lock", cmd: "/lock", user: "maint", action: "Issues.Lock"},
+		{name: "reason", cmd: "/lock", args: []string{"Too", "heated"}, user: "maint", action: "Issues.Lock", reason: "too heated"},
+		{name: "unknown reason", cmd: "/lock", args: []string{"boring"}, user: "maint", err: invalid},
+		{name: "unlock", cmd: "/unlock", user: "maint", action: "Issues.Unlock"},
+		{name: "unlock reason", cmd: "/unlock", args: []string{"resolved"}, user: "maint", err: invalid},
+		{name: "author", cmd: "/lock", user: "author", err: &skippedError{outcome: "ignored", reason: "user author is not a maintainer"}},
+		{name: "inactive", cmd: "/unlock", user: "inactive", err: &skippedError{outcome: "ignored", reason: "user inactive is not a maintainer"}},
+	}
+	for _, test := range tests {
+		var reason string
+		b, _, close := newTestBot(t, withRoutes(map[string]interface{}{
+			"PUT /repos/o/r/issues/1/lock": func(r *http.Request) (int, interface{}) {
+				var opt github.LockIssueOptions
+				json.NewDecoder(r.Body).Decode(&opt)
+				reason = opt.LockReason
+				return http.StatusNoContent, nil
+			},
+			"DELETE /repos/o/r/issues/1/lock": func(r *http.Request) (int, interface{}) {
+				return http.StatusNoContent, nil
+			},
+		}))
+		b.cfg.Maintainers = []config.Maintainers{{Repos: []string{"o"}, Team: "maint"}}
+
+		c := &command{owner: "o", repo: "r", number: 1, author: "author", user: test.user, cmd: test.cmd, args: test.args}
+		if err := b.cmdLock(context.Background(), c); !reflect.DeepEqual(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+		var want []string
+		if len(test.action) > 0 {
+			want = []string{test.action}
+		}
+		if got := auditActions(t, b); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got actions %v, want %v", test.name, got, want)
+		}
+		if reason != test.reason {
+			t.Errorf("%s: got reason %q, want %q", test.name, reason, test.reason)
+		}
+		close()
+	}
+}
@@ -0,0 +1,604 @@
+package config
+
+import (
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the bot configuration loaded from a yaml file
+type Config struct {
+	Queue   QueueConfig   `yaml:"queue"`
+	Command CommandConfig `yaml:"command"`
+	Audit   AuditConfig   `yaml:"audit"`
+	Admin   AdminConfig   `yaml:"admin"`
+
+	Presets   PresetsConfig   `yaml:"presets"`
+	LabelSync LabelSyncConfig `yaml:"label_sync"`
+
+	Size       SizeConfig         `yaml:"size"`
+	AreaLabels []AreaLabelsConfig `yaml:"area_labels"`
+	Reviewers  ReviewersConfig    `yaml:"reviewers"`
+	CI         CIConfig           `yaml:"ci"`
+
+	NeedsRebase NeedsRebaseConfig `yaml:"needs_rebase"`
+	Lifecycle   LifecycleConfig   `yaml:"lifecycle"`
+	ReleaseNote ReleaseNoteConfig `yaml:"release_note"`
+	DCO         DCOConfig         `yaml:"dco"`
+	Policy      PolicyConfig      `yaml:"policy"`
+
+	Jobs JobsConfig `yaml:"jobs"`
+
+	LabelCategories []LabelCategory `yaml:"label_categories"`
+	Maintainers     []Maintainers   `yaml:"maintainers"`
+}
+
+// QueueConfig controls how commands are scheduled across repos
+type QueueConfig struct {
+	// Workers is the number of commands processed concurrently
+	Workers int `yaml:"workers"`
+	// Capacity is the maximum number of pending commands. Once it is
+	// reached, webhook requests are rejected with 503.
+	Capacity int `yaml:"capacity"`
+	// RetryAfter is sent back to GitHub when the queue is full
+	RetryAfter time.Duration `yaml:"retry_after"`
+	// Weight is the default share of a repo
+	Weight int `yaml:"weight"`
+	// Concurrency is the default number of commands of a repo
+	// processed at the same time
+	Concurrency int `yaml:"concurrency"`
+	// Tenants overrides weight and concurrency for the repos of an org,
+	// or for a repo
+	Tenants []TenantConfig `yaml:"tenants"`
+	// OrgWeight is the default share of an org as a whole, its repos
+	// sharing it by their weights
+	OrgWeight int `yaml:"org_weight"`
+	// OrgConcurrency is the default number of commands of an org as a
+	// whole processed at the same time, defaulting to workers
+	OrgConcurrency int `yaml:"org_concurrency"`
+	// Orgs overrides weight and concurrency of an org as a whole
+	Orgs []TenantConfig `yaml:"orgs"`
+}
+
+// CommandConfig controls how a single command is run
+type CommandConfig struct {
+	// Timeout bounds all GitHub requests made by one attempt of a command
+	Timeout time.Duration `yaml:"timeout"`
+	// DescriptionEdits runs commands added to the description of an issue
+	// (or pullrequest) when it is edited, not only when it is opened
+	DescriptionEdits bool `yaml:"description_edits"`
+}
+
+// AuditConfig controls the audit log of bot actions
+type AuditConfig struct {
+	// Path of the append-only audit log
+	Path string `yaml:"path"`
+}
+
+// AdminConfig controls the admin api, which is served apart from webhooks
+type AdminConfig struct {
+	// Addr the admin api listens on
+	Addr string `yaml:"addr"`
+	// TLS serves the admin api over https, and authenticates clients by
+	// certificate if a client CA is set
+	TLS AdminTLSConfig `yaml:"tls"`
+	// Tokens authenticate clients by bearer token
+	Tokens []AdminToken `yaml:"tokens"`
+	// Clients authorizes clients authenticated by certificate
+	Clients []AdminClient `yaml:"clients"`
+}
+
+// AdminTLSConfig locates pem files of the admin api
+type AdminTLSConfig struct {
+	Cert     string `yaml:"cert"`
+	Key      string `yaml:"key"`
+	ClientCA string `yaml:"client_ca"`
+}
+
+// AdminToken is a bearer token and what it is allowed to do.
+// A scope is "<api>:<verb>", e.g. labels:write, optionally restricted to an
+// org as "<api>:<verb>:<org>". "*" allows everything.
+type AdminToken struct {
+	Name   string   `yaml:"name"`
+	Token  string   `yaml:"token"`
+	Scopes []string `yaml:"scopes"`
+}
+
+// AdminClient grants scopes to the client certificate of a common name
+type AdminClient struct {
+	CommonName string   `yaml:"common_name"`
+	Scopes     []string `yaml:"scopes"`
+}
+
+// PresetsConfig locates preset label files (json or yaml). Org and repo
+// presets add labels to, or override labels of the global preset.
+type PresetsConfig struct {
+	// File is the global preset, there's none if empty
+	File string `yaml:"file"`
+	// Orgs maps an org to its preset file
+	Orgs map[string]string `yaml:"orgs"`
+	// Repos maps owner/repo to its preset file
+	Repos map[string]string `yaml:"repos"`
+}
+
+// LabelSyncConfig periodically makes repo labels match a label file
+type LabelSyncConfig struct {
+	// Interval between two syncs, zero disables periodic sync
+	Interval time.Duration `yaml:"interval"`
+	// File holds the desired labels, preset labels are used if empty
+	File string `yaml:"file"`
+	// Orgs are synced repo by repo
+	Orgs []string `yaml:"orgs"`
+	// Repos are owner/repo names
+	Repos []string `yaml:"repos"`
+	// Delete removes labels which are not in File
+	Delete bool `yaml:"delete"`
+}
+
+// SizeConfig labels pullrequests by the number of changed lines
+type SizeConfig struct {
+	// Repos are orgs ("owner") or repos ("owner/repo") the plugin runs on
+	Repos []string `yaml:"repos"`
+	// Thresholds are the minimum changed lines of each size, smaller
+	// pullrequests are size/XS
+	Thresholds SizeThresholds `yaml:"thresholds"`
+	// Ignore are globs of files which are not counted, besides vendor/ and
+	// files marked linguist-generated in .gitattributes
+	Ignore []string `yaml:"ignore"`
+}
+
+// SizeThresholds are the minimum changed lines of each size label
+type SizeThresholds struct {
+	S   int `yaml:"s"`
+	M   int `yaml:"m"`
+	L   int `yaml:"l"`
+	XL  int `yaml:"xl"`
+	XXL int `yaml:"xxl"`
+}
+
+// Enabled returns whether the plugin runs on owner/repo
+func (s *SizeConfig) Enabled(owner, repo string) bool {
+	return matchRepo(s.Repos, owner, repo)
+}
+
+// AreaLabelsConfig labels pullrequests by the paths of changed files
+type AreaLabelsConfig struct {
+	// Repos are orgs ("owner") or repos ("owner/repo") the mapping applies to
+	Repos []string `yaml:"repos"`
+	// Paths maps a glob of changed files to a label, e.g. web/** to area/frontend
+	Paths map[string]string `yaml:"paths"`
+}
+
+// AreaLabelsFor returns the path to label mapping of owner/repo.
+// A mapping of the repo takes precedence over the mapping of its org.
+func (c *Config) AreaLabelsFor(owner, repo string) map[string]string {
+	var paths map[string]string
+	best := 0
+	for _, a := range c.AreaLabels {
+		if l := matchLevel(a.Repos, owner, repo); l > best {
+			paths, best = a.Paths, l
+		}
+	}
+	return paths
+}
+
+// ReviewersConfig requests reviews when a pullrequest is opened
+type ReviewersConfig struct {
+	// Count is the number of reviewers requested
+	Count int `yaml:"count"`
+	// Vacation are users who are never requested
+	Vacation []string `yaml:"vacation"`
+	// Rules selects candidates of repos
+	Rules []ReviewerRule `yaml:"rules"`
+}
+
+// ReviewerRule selects reviewer candidates of changed files
+type ReviewerRule struct {
+	// Repos are orgs ("owner") or repos ("owner/repo") the rule applies to
+	Repos []string `yaml:"repos"`
+	// OwnersFiles picks reviewers of the closest OWNERS file of a file
+	OwnersFiles bool `yaml:"owners_files"`
+	// Paths maps a glob of changed files to reviewers
+	Paths map[string][]string `yaml:"paths"`
+}
+
+// RuleFor returns the rule of owner/repo, nil if there's none.
+// A rule of the repo takes precedence over the rule of its org.
+func (r *ReviewersConfig) RuleFor(owner, repo string) *ReviewerRule {
+	var rule *ReviewerRule
+	best := 0
+	for i := range r.Rules {
+		if l := matchLevel(r.Rules[i].Repos, owner, repo); l > best {
+			rule, best = &r.Rules[i], l
+		}
+	}
+	return rule
+}
+
+// NeedsRebaseConfig labels pullrequests having conflicts with their base
+type NeedsRebaseConfig struct {
+	// Repos are orgs ("owner") or repos ("owner/repo") the plugin runs on
+	Repos []string `yaml:"repos"`
+}
+
+// Enabled returns whether the plugin runs on owner/repo
+func (n *NeedsRebaseConfig) Enabled(owner, repo string) bool {
+	return matchRepo(n.Repos, owner, repo)
+}
+
+// ReleaseNoteConfig requires a release note in descriptions of pullrequests
+type ReleaseNoteConfig struct {
+	// Repos are orgs ("owner") or repos ("owner/repo") the plugin runs on
+	Repos []string `yaml:"repos"`
+}
+
+// Enabled returns whether the plugin runs on owner/repo
+func (r *ReleaseNoteConfig) Enabled(owner, repo string) bool {
+	return matchRepo(r.Repos, owner, repo)
+}
+
+// DCOConfig checks that commits of pullrequests are signed off
+type DCOConfig struct {
+	// Repos are orgs ("owner") or repos ("owner/repo") the plugin runs on
+	Repos []string `yaml:"repos"`
+}
+
+// Enabled returns whether the plugin runs on owner/repo
+func (d *DCOConfig) Enabled(owner, repo string) bool {
+	return matchRepo(d.Repos, owner, repo)
+}
+
+// PolicyConfig checks titles, commit subjects and branch names of
+// pullrequests
+type PolicyConfig struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule holds the checks of repos
+type PolicyRule struct {
+	// Repos are orgs ("owner") or repos ("owner/repo") the rule applies to
+	Repos []string `yaml:"repos"`
+	// Title checks the title of a pullrequest
+	Title PolicyCheck `yaml:"title"`
+	// CommitSubject checks the first line of every commit message
+	CommitSubject PolicyCheck `yaml:"commit_subject"`
+	// Branch checks the name of the head branch
+	Branch PolicyCheck `yaml:"branch"`
+}
+
+// PolicyCheck is a check of a text, it's off if it has neither a pattern
+// nor a max length
+type PolicyCheck struct {
+	// Pattern is a regular expression the text must match
+	Pattern string `yaml:"pattern"`
+	// MaxLength of the text in characters, unlimited if zero
+	MaxLength int `yaml:"max_length"`
+	// Blocking fails the check run on a violation, otherwise it's a warning
+	Blocking bool `yaml:"blocking"`
+}
+
+// Enabled returns whether the check is on
+func (p *PolicyCheck) Enabled() bool {
+	return len(p.Pattern) > 0 || p.MaxLength > 0
+}
+
+// RuleFor returns the rule of owner/repo, nil if there's none.
+// A rule of the repo takes precedence over the rule of its org.
+func (p *PolicyConfig) RuleFor(owner, repo string) *PolicyRule {
+	var rule *PolicyRule
+	best := 0
+	for i := range p.Rules {
+		if m := matchLevel(p.Rules[i].Repos, owner, repo); m > best {
+			rule, best = &p.Rules[i], m
+		}
+	}
+	return rule
+}
+
+// LabelCategory is a prefix of labels managed by the commands
+// /<name> <value>... and /remove-<name> <value>..., e.g. /kind bug for kind/bug
+type LabelCategory struct {
+	Name string `yaml:"name"`
+	// Repos are orgs ("owner") or repos ("owner/repo") the category applies
+	// to, every repo if empty
+	Repos []string `yaml:"repos"`
+	// Exclusive allows one label of the category, adding one removes others
+	Exclusive bool `yaml:"exclusive"`
+	// Roles may use the commands, anyone if empty. A role is one of author,
+	// member (of the org), collaborator (of the repo) and maintainer.
+	Roles []string `yaml:"roles"`
+}
+
+// defaultLabelCategories are used if none is configured
+var defaultLabelCategories = []LabelCategory{{Name: "kind"}, {Name: "area"}, {Name: "task"}}
+
+// LabelCategory returns the category name of owner/repo, nil if there's
+// none. A category of the repo takes precedence over one of its org, which
+// takes precedence over one of every repo.
+func (c *Config) LabelCategory(name, owner, repo string) *LabelCategory {
+	var category *LabelCategory
+	best := -1
+	for i := range c.LabelCategories {
+		lc := &c.LabelCategories[i]
+		if !strings.EqualFold(lc.Name, name) {
+			continue
+		}
+		l := matchLevel(lc.Repos, owner, repo)
+		if l == 0 && len(lc.Repos) > 0 {
+			continue
+		}
+		if l > best {
+			category, best = lc, l
+		}
+	}
+	return category
+}
+
+// Maintainers is the team maintaining repos, who may use commands such as
+// /milestone and /lock
+type Maintainers struct {
+	// Repos are orgs ("owner") or repos ("owner/repo") the team maintains
+	Repos []string `yaml:"repos"`
+	// Team is the slug of a team of the org
+	Team string `yaml:"team"`
+}
+
+// MaintainersOf returns the maintainers of owner/repo, nil if there's none.
+// Maintainers of the repo take precedence over maintainers of its org.
+func (c *Config) MaintainersOf(owner, repo string) *Maintainers {
+	var m *Maintainers
+	best := 0
+	for i := range c.Maintainers {
+		if l := matchLevel(c.Maintainers[i].Repos, owner, repo); l > best {
+			m, best = &c.Maintainers[i], l
+		}
+	}
+	return m
+}
+
+// JobsConfig controls periodic jobs, intervals are set in the config of
+// each job, e.g. label_sync.interval
+type JobsConfig struct {
+	// Jitter delays a run by up to jitter*interval at random, 0.1 if
+	// unset. 0 disables it.
+	Jitter *float64 `yaml:"jitter"`
+	// Timeout bounds a run, the interval of the job is used if zero
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// LifecycleConfig controls the sweeper marking inactive issues (and
+// pullrequests) stale, then rotten, then closing them
+type LifecycleConfig struct {
+	// Interval between two sweeps, zero disables the sweeper
+	Interval time.Duration `yaml:"interval"`
+	// Rules are thresholds of repos, only repos of a rule are swept
+	Rules []LifecycleRule `yaml:"rules"`
+}
+
+// LifecycleRule holds thresholds in days of inactivity
+type LifecycleRule struct {
+	// Repos are orgs ("owner") or repos ("owner/repo") the rule applies to
+	Repos []string `yaml:"repos"`
+	// StaleDays of inactivity mark an issue stale
+	StaleDays int `yaml:"stale_days"`
+	// RottenDays more of inactivity mark a stale issue rotten
+	RottenDays int `yaml:"rotten_days"`
+	// CloseDays more of inactivity close a rotten issue
+	CloseDays int `yaml:"close_days"`
+}
+
+// RuleFor returns the rule of owner/repo, nil if there's none.
+// A rule of the repo takes precedence over the rule of its org.
+func (l *LifecycleConfig) RuleFor(owner, repo string) *LifecycleRule {
+	var rule *LifecycleRule
+	best := 0
+	for i := range l.Rules {
+		if m := matchLevel(l.Rules[i].Repos, owner, repo); m > best {
+			rule, best = &l.Rules[i], m
+		}
+	}
+	return rule
+}
+
+// CIConfig controls how /retest and /test rerun CI
+type CIConfig struct {
+	// Triggers rerun status based CI, check runs are re-requested on GitHub
+	Triggers []CITrigger `yaml:"triggers"`
+}
+
+// CITrigger is an http endpoint that reruns status contexts of repos.
+// The bot posts {"owner", "repo", "number", "sha", "context", "user"} as json.
+type CITrigger struct {
+	// Repos are orgs ("owner") or repos ("owner/repo") the trigger applies to
+	Repos []string `yaml:"repos"`
+	// Contexts are status contexts the trigger reruns, empty for any
+	Contexts []string `yaml:"contexts"`
+	URL      string   `yaml:"url"`
+	// Token is sent as a bearer token if set
+	Token string `yaml:"token"`
+}
+
+// TriggerFor returns the trigger of a status context of owner/repo, nil if
+// there's none. A trigger of the repo takes precedence over one of its org.
+func (c *CIConfig) TriggerFor(owner, repo, context string) *CITrigger {
+	var trigger *CITrigger
+	best := 0
+	for i := range c.Triggers {
+		t := &c.Triggers[i]
+		if !t.handles(context) {
+			continue
+		}
+		if l := matchLevel(t.Repos, owner, repo); l > best {
+			trigger, best = t, l
+		}
+	}
+	return trigger
+}
+
+func (t *CITrigger) handles(context string) bool {
+	if len(t.Contexts) == 0 {
+		return true
+	}
+	for _, c := range t.Contexts {
+		if strings.EqualFold(c, context) {
+			return true
+		}
+	}
+	return false
+}
+
+// TenantConfig overrides scheduling of an org ("owner") or a repo ("owner/repo")
+type TenantConfig struct {
+	Name        string `yaml:"name"`
+	Weight      int    `yaml:"weight"`
+	Concurrency int    `yaml:"concurrency"`
+}
+
+// Load reads config from path. Defaults are returned if path is empty.
+func Load(path string) (*Config, error) {
+	c := new(Config)
+	if len(path) > 0 {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(b, c); err != nil {
+			return nil, err
+		}
+	}
+	c.setDefaults()
+	return c, nil
+}
+
+func (c *Config) setDefaults() {
+	q := &c.Queue
+	if q.Workers <= 0 {
+		q.Workers = 4
+	}
+	if q.Capacity <= 0 {
+		q.Capacity = 1000
+	}
+	if q.RetryAfter <= 0 {
+		q.RetryAfter = 30 * time.Second
+	}
+	if q.Weight <= 0 {
+		q.Weight = 1
+	}
+	if q.Concurrency <= 0 {
+		q.Concurrency = 1
+	}
+	if q.OrgWeight <= 0 {
+		q.OrgWeight = 1
+	}
+	if q.OrgConcurrency <= 0 {
+		q.OrgConcurrency = q.Workers
+	}
+	if c.Command.Timeout <= 0 {
+		c.Command.Timeout = 30 * time.Second
+	}
+	if len(c.Audit.Path) == 0 {
+		c.Audit.Path = "audit.jsonl"
+	}
+	if len(c.Admin.Addr) == 0 {
+		c.Admin.Addr = ":11112"
+	}
+	t := &c.Size.Thresholds
+	for _, d := range []struct {
+		v   *int
+		def int
+	}{{&t.S, 10}, {&t.M, 30}, {&t.L, 100}, {&t.XL, 500}, {&t.XXL, 1000}} {
+		if *d.v <= 0 {
+			*d.v = d.def
+		}
+	}
+	if c.Reviewers.Count <= 0 {
+		c.Reviewers.Count = 2
+	}
+	for i := range c.Lifecycle.Rules {
+		r := &c.Lifecycle.Rules[i]
+		if r.StaleDays <= 0 {
+			r.StaleDays = 90
+		}
+		if r.RottenDays <= 0 {
+			r.RottenDays = 30
+		}
+		if r.CloseDays <= 0 {
+			r.CloseDays = 30
+		}
+	}
+	if len(c.LabelCategories) == 0 {
+		c.LabelCategories = defaultLabelCategories
+	}
+	if c.Jobs.Jitter == nil {
+		jitter := 0.1
+		c.Jobs.Jitter = &jitter
+	}
+}
+
+// Tenant returns weight and concurrency of owner/repo.
+// Repo settings take precedence over org settings.
+func (q *QueueConfig) Tenant(owner, repo string) (weight, concurrency int) {
+	weight, concurrency = q.Weight, q.Concurrency
+	if t := q.lookup(owner); t != nil {
+		weight, concurrency = override(t, weight, concurrency)
+	}
+	if t := q.lookup(owner + "/" + repo); t != nil {
+		weight, concurrency = override(t, weight, concurrency)
+	}
+	return weight, concurrency
+}
+
+// Org returns weight and concurrency of owner as a whole
+func (q *QueueConfig) Org(owner string) (weight, concurrency int) {
+	weight, concurrency = q.OrgWeight, q.OrgConcurrency
+	if t := lookupTenant(q.Orgs, owner); t != nil {
+		weight, concurrency = override(t, weight, concurrency)
+	}
+	return weight, concurrency
+}
+
+func (q *QueueConfig) lookup(name string) *TenantConfig {
+	return lookupTenant(q.Tenants, name)
+}
+
+func lookupTenant(tenants []TenantConfig, name string) *TenantConfig {
+	for i := range tenants {
+		if strings.EqualFold(tenants[i].Name, name) {
+			return &tenants[i]
+		}
+	}
+	return nil
+}
+
+func override(t *TenantConfig, weight, concurrency int) (int, int) {
+	if t.Weight > 0 {
+		weight = t.Weight
+	}
+	if t.Concurrency > 0 {
+		concurrency = t.Concurrency
+	}
+	return weight, concurrency
+}
+
+// matchRepo returns whether owner/repo is one of names, where a name is an
+// org ("owner") or a repo ("owner/repo")
+func matchRepo(names []string, owner, repo string) bool {
+	return matchLevel(names, owner, repo) > 0
+}
+
+// matchLevel returns how specifically names match owner/repo:
+// 2 for the repo, 1 for its org, 0 for no match
+func matchLevel(names []string, owner, repo string) int {
+	level := 0
+	for _, n := range names {
+		switch {
+		case strings.EqualFold(n, owner+"/"+repo):
+			return 2
+		case strings.EqualFold(n, owner):
+			level = 1
+		}
+	}
+	return level
+}
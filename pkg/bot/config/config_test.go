@@ -0,0 +1,29 @@
+package config
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestJobsJitter(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want float64
+	}{
+		{"unset", "", 0.1},
+		{"disabled", "jobs:\n  jitter: 0\n", 0},
+		{"set", "jobs:\n  jitter: 0.5\n", 0.5},
+	}
+	for _, test := range tests {
+		c := new(Config)
+		if err := yaml.UnmarshalStrict([]byte(test.yaml), c); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		c.setDefaults()
+		if got := *c.Jobs.Jitter; got != test.want {
+			t.Errorf("%s: got jitter %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/labels"
+)
+
+// dcoContext is the commit status of the sign-off check
+const dcoContext = "dco"
+
+// signedOffBy matches a Signed-off-by trailer, e.g.
+// Signed-off-by: Random J Developer <random@developer.example.org>
+var signedOffBy = regexp.MustCompile(`(?mi)^Signed-off-by:\s*(.*?)\s*<([^>]+)>\s*$`)
+
+// cmdDCO checks that every commit of the pullrequest of c is signed off by
+// its author. The result is reported as the dco commit status of the head,
+// and while commits aren't signed off the pullrequest is labeled
+// dco-signoff: no. The author is told which commits to fix when the label
+// is added. The reply is posted before the label and marked with the head,
+// so that a retry neither loses nor repeats it.
+func (b *Bot) cmdDCO(ctx context.Context, c *command) error {
+	e, ok := c.event.(*github.PullRequestEvent)
+	if !ok {
+		return c.invalid()
+	}
+	commits, err := b.prCommits(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	// commits are listed oldest first, span counts the commits to rebase
+	var unsigned []*github.RepositoryCommit
+	span := 0
+	for i, rc := range commits {
+		// merge commits, e.g. of the base branch, are made by tools
+		if len(rc.Parents) > 1 {
+			continue
+		}
+		if !signedOff(rc.Commit) {
+			if len(unsigned) == 0 {
+				span = len(commits) - i
+			}
+			unsigned = append(unsigned, rc)
+		}
+	}
+
+	status := &github.RepoStatus{
+		State:       github.String("success"),
+		Description: github.String("All commits are signed off"),
+		Context:     github.String(dcoContext),
+	}
+	if len(unsigned) > 0 {
+		status.State = github.String("failure")
+		status.Description = github.String(fmt.Sprintf("%d commit(s) lack a Signed-off-by of their author", len(unsigned)))
+	}
+	head := e.PullRequest.Head.GetSHA()
+	if err := b.createStatus(ctx, c, head, status); err != nil {
+		return err
+	}
+
+	current, err := b.issueLabels(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	has := containsFold(current, labels.DCOSignoffNo)
+	switch {
+	case len(unsigned) > 0 && !has:
+		// comment only when the label is added, not on every push
+		marker := dcoMarker(head)
+		replied, err := b.hasComment(ctx, c, marker)
+		if err != nil {
+			return err
+		}
+		if !replied {
+			if err := b.comment(ctx, c, dcoReply(c, unsigned, span)+"\n"+marker+"\n"); err != nil {
+				return err
+			}
+		}
+		if err := b.addLabels(ctx, c, labels.DCOSignoffNo); err != nil {
+			return err
+		}
+		c.log().Infof("labeled %s, %d commit(s) not signed off", labels.DCOSignoffNo, len(unsigned))
+	case len(unsigned) == 0 && has:
+		if err := b.removeLabel(ctx, c, labels.DCOSignoffNo); err != nil {
+			return err
+		}
+		c.log().Infof("removed %s", labels.DCOSignoffNo)
+	}
+	return nil
+}
+
+// signedOff returns whether commit has a Signed-off-by trailer of its
+// author, matched by email
+func signedOff(commit *github.Commit) bool {
+	email := commit.Author.GetEmail()
+	for _, m := range signedOffBy.FindAllStringSubmatch(commit.GetMessage(), -1) {
+		if strings.EqualFold(strings.TrimSpace(m[2]), email) {
+			return true
+		}
+	}
+	return false
+}
+
+// dcoMarker is a hidden line of the reply on head
+func dcoMarker(head string) string {
+	return fmt.Sprintf("<!-- dco-signoff: %s -->", head)
+}
+
+// hasComment returns whether a comment on the issue of c contains s
+func (b *Bot) hasComment(ctx context.Context, c *command, s string) (bool, error) {
+	opt := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{Page: 1, PerPage: 100}}
+	for opt.Page > 0 {
+		comments, resp, err := b.git.Issues.ListComments(ctx, c.owner, c.repo, c.number, opt)
+		if err != nil {
+			return false, err
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.GetBody(), s) {
+				return true, nil
+			}
+		}
+		opt.Page = resp.NextPage
+	}
+	return false, nil
+}
+
+// dcoReply lists commits which are not signed off and tells how to fix them
+// by rebasing the last span commits
+func dcoReply(c *command, unsigned []*github.RepositoryCommit, span int) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "@%s: thanks for your PR! These commits lack a `Signed-off-by` trailer matching their author:\n\n", c.author)
+	for _, rc := range unsigned {
+		subject := strings.SplitN(rc.Commit.GetMessage(), "\n", 2)[0]
+		fmt.Fprintf(&buf, "- %s %s (%s)\n", rc.GetSHA(), subject, rc.Commit.Author.GetEmail())
+	}
+	fmt.Fprintf(&buf, "\nSign off by committing with `git commit -s`, using the email of the commit author. ")
+	fmt.Fprintf(&buf, "To sign off existing commits, rebase and force-push the branch:\n\n")
+	fmt.Fprintf(&buf, "```sh\ngit rebase --signoff HEAD~%d\ngit push --force-with-lease\n```\n", span)
+	return buf.String()
+}
@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func testCommit(email, message string) *github.Commit {
+	return &github.Commit{
+		Author:  &github.CommitAuthor{Email: github.String(email)},
+		Message: github.String(message),
+	}
+}
+
+func TestSignedOff(t *testing.T) {
+	tests := []struct {
+		name    string
+		email   string
+		message string
+		want    bool
+	}{
+		{"signed off", "dev@example.org", "Fix x\n\nSigned-off-by: Dev <dev@example.org>", true},
+		{"email case", "Dev@Example.org", "Fix x\n\nSigned-off-by: Dev <dev@example.org>", true},
+		{"trailer case", "dev@example.org", "Fix x\n\nsigned-off-by: Dev <dev@example.org>", true},
+		{"crlf", "dev@example.org", "Fix x\r\n\r\nSigned-off-by: Dev <dev@example.org>\r\n", true},
+		{"one of several", "dev@example.org", "Fix x\n\nSigned-off-by: Other <other@example.org>\nSigned-off-by: Dev <dev@example.org>", true},
+		{"not signed off", "dev@example.org", "Fix x", false},
+		{"other email", "dev@example.org", "Fix x\n\nSigned-off-by: Other <other@example.org>", false},
+		{"no email", "dev@example.org", "Fix x\n\nSigned-off-by: Dev", false},
+		{"mid line", "dev@example.org", "Fix x, see Signed-off-by: Dev <dev@example.org>", false},
+	}
+	for _, test := range tests {
+		if got := signedOff(testCommit(test.email, test.message)); got != test.want {
+			t.Errorf("%s: signedOff() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDCOReply(t *testing.T) {
+	c := &command{author: "dev"}
+	unsigned := []*github.RepositoryCommit{
+		{SHA: github.String("1234567890abcdef"), Commit: testCommit("dev@example.org", "Fix x\n\nLonger description")},
+	}
+	reply := dcoReply(c, unsigned, 3)
+	for _, want := range []string{
+		"@dev:",
+		"- 1234567890abcdef Fix x (dev@example.org)\n",
+		"git rebase --signoff HEAD~3\n",
+	} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("reply lacks %q:\n%s", want, reply)
+		}
+	}
+	if strings.Contains(reply, "Longer description") {
+		t.Errorf("reply has more than the subject of a commit:\n%s", reply)
+	}
+}
+
+func TestDCOMarker(t *testing.T) {
+	a, b := dcoMarker("aaaa"), dcoMarker("bbbb")
+	if a == b || strings.Contains(a, "bbbb") {
+		t.Errorf("markers of different heads are alike: %q, %q", a, b)
+	}
+	if !strings.HasPrefix(a, "<!--") || !strings.HasSuffix(a, "-->") {
+		t.Errorf("marker %q is not hidden", a)
+	}
+}
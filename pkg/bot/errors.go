@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/google/go-github/github"
+)
+
+// permanentError wraps an error which retrying the command won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// permanent marks err as not retryable
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// retryableError wraps a transient error, e.g. a state GitHub computes in
+// the background
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+// retryable marks err as transient, so that the command is retried
+func retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+// skippedError means a command was deliberately not run
+type skippedError struct {
+	outcome string // invalid or ignored
+	reason  string
+}
+
+func (e *skippedError) Error() string {
+	return e.reason
+}
+
+// isRetryable classifies errors returned by command handlers.
+// Timeouts, rate limits, server errors, network errors and errors marked
+// retryable are retried; anything else, e.g. client errors, a full queue
+// or cancellation (shutdown), is not.
+func isRetryable(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *permanentError, *skippedError:
+		return false
+	case *retryableError:
+		return true
+	case *github.RateLimitError, *github.AbuseRateLimitError:
+		return true
+	case *github.ErrorResponse:
+		if e.Response == nil {
+			return true
+		}
+		code := e.Response.StatusCode
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+	case *url.Error:
+		// the request failed on its way, unless it was canceled
+		return e.Err != context.Canceled
+	case net.Error:
+		return true
+	}
+	return err == context.DeadlineExceeded
+}
+
+// isForbidden returns whether GitHub refused a request with 403, e.g. an
+// endpoint of GitHub Apps called with a token
+func isForbidden(err error) bool {
+	e, ok := err.(*github.ErrorResponse)
+	return ok && e.Response != nil && e.Response.StatusCode == http.StatusForbidden
+}
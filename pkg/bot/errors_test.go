@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/queue"
+)
+
+func githubError(code int) error {
+	return &github.ErrorResponse{Response: &http.Response{StatusCode: code}}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"permanent", permanent(errors.New("bad config")), false},
+		{"skipped", &skippedError{outcome: "ignored", reason: "not a member"}, false},
+		{"rate limit", &github.RateLimitError{}, true},
+		{"abuse rate limit", &github.AbuseRateLimitError{}, true},
+		{"server error", githubError(http.StatusBadGateway), true},
+		{"too many requests", githubError(http.StatusTooManyRequests), true},
+		{"not found", githubError(http.StatusNotFound), false},
+		{"unprocessable", githubError(http.StatusUnprocessableEntity), false},
+		{"no response", &github.ErrorResponse{}, true},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"url wrapping timeout", &url.Error{Op: "Get", URL: "https://api.github.com", Err: context.DeadlineExceeded}, true},
+		{"url wrapping cancel", &url.Error{Op: "Get", URL: "https://api.github.com", Err: context.Canceled}, false},
+		{"deadline", context.DeadlineExceeded, true},
+		{"canceled", context.Canceled, false},
+		{"url wrapping EOF", &url.Error{Op: "Get", URL: "https://api.github.com", Err: io.ErrUnexpectedEOF}, true},
+		{"retryable", retryable(errors.New("not ready")), true},
+		{"mergeability unknown", errMergeableUnknown, true},
+		{"queue full", queue.ErrFull, false},
+		{"formatted", fmt.Errorf("repo %q should be owner/repo", "gitbot"), false},
+		{"unknown", errors.New("unexpected EOF"), false},
+	}
+	for _, test := range tests {
+		if got := isRetryable(test.err); got != test.want {
+			t.Errorf("%s: isRetryable(%v) = %v, want %v", test.name, test.err, got, test.want)
+		}
+	}
+}
+
+func TestIsForbidden(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{githubError(http.StatusForbidden), true},
+		{githubError(http.StatusNotFound), false},
+		{&github.ErrorResponse{}, false},
+		{errors.New("403 Forbidden"), false},
+	}
+	for _, test := range tests {
+		if got := isForbidden(test.err); got != test.want {
+			t.Errorf("isForbidden(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/audit"
+	"github.com/dastanng/gitbot/pkg/bot/config"
+)
+
+// fakeGitHub serves canned responses of the GitHub api by "METHOD /path",
+// e.g. "GET /repos/o/r/issues/1". A response is a json value, raw []byte,
+// or a func(*http.Request) (int, interface{}) choosing the status too.
+// Unknown routes are answered by 404.
+type fakeGitHub struct {
+	mu     sync.Mutex
+	routes map[string]interface{}
+	calls  []string
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := r.Method + " " + r.URL.Path
+	f.mu.Lock()
+	f.calls = append(f.calls, route)
+	resp, ok := f.routes[route]
+	f.mu.Unlock()
+
+	status, body := http.StatusOK, resp
+	switch v := resp.(type) {
+	case func(*http.Request) (int, interface{}):
+		status, body = v(r)
+	case nil:
+		if !ok {
+			status, body = http.StatusNotFound, map[string]string{"message": "Not Found"}
+		}
+	}
+	if raw, ok := body.([]byte); ok {
+		w.WriteHeader(status)
+		w.Write(raw)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body != nil {
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// called returns whether route was requested
+func (f *fakeGitHub) called(route string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.calls {
+		if c == route {
+			return true
+		}
+	}
+	return false
+}
+
+// newTestBot returns a bot with the default config, talking to a fake
+// GitHub serving routes, and auditing to a temporary log. close releases
+// both.
+func newTestBot(t *testing.T, routes map[string]interface{}) (b *Bot, gh *fakeGitHub, close func()) {
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := audit.Open(filepath.Join(dir, "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gh = &fakeGitHub{routes: routes}
+	srv := httptest.NewServer(gh)
+	b = &Bot{cfg: cfg, audit: store, git: github.NewClient(srv.Client())}
+	b.git.BaseURL, _ = url.Parse(srv.URL + "/")
+	return b, gh, func() {
+		srv.Close()
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// auditActions returns the actions of the audit log of b, oldest first
+func auditActions(t *testing.T, b *Bot) []string {
+	records, err := b.audit.Query(audit.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, r := range records {
+		actions = append(actions, r.Action)
+	}
+	return actions
+}
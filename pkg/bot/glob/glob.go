@@ -0,0 +1,53 @@
+// Package glob matches slash separated file paths against glob patterns.
+package glob
+
+import (
+	"path"
+	"strings"
+)
+
+// Match returns whether name matches pattern. Besides the syntax of
+// path.Match, "**" matches any number of directories. A pattern without
+// a slash matches the base name at any depth, a pattern ending with a slash
+// matches everything under the directory, as in .gitattributes.
+func Match(pattern, name string) bool {
+	if !strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		pattern = "**/" + pattern
+	}
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	return match(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// Any returns whether name matches any of patterns
+func Any(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if Match(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func match(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if match(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,55 @@
+package glob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "pkg/bot/bot.go", true},
+		{"*.go", "main.go.orig", false},
+		{"bot.go", "pkg/bot/bot.go", true},
+		{"pkg/*.go", "pkg/main.go", true},
+		{"pkg/*.go", "pkg/bot/bot.go", false},
+		{"/pkg/*.go", "pkg/main.go", true},
+		{"pkg/**/*.go", "pkg/main.go", true},
+		{"pkg/**/*.go", "pkg/bot/labels/sync.go", true},
+		{"pkg/**", "pkg/bot/bot.go", true},
+		{"pkg/**", "cmd/bot/main.go", false},
+		{"**/labels/*", "pkg/bot/labels/sync.go", true},
+		{"docs/", "docs/config.md", true},
+		{"docs/", "docs/images/queue.png", true},
+		{"docs/", "pkg/docs/config.md", true},
+		{"/docs/", "pkg/docs/config.md", false},
+		{"vendor/", "pkg/vendor/a.go", true},
+		{"[a-c]*.md", "docs/b.md", true},
+		{"[a-c]*.md", "docs/d.md", false},
+		{"?.go", "a.go", true},
+		{"?.go", "ab.go", false},
+		{"[", "[", false},
+	}
+	for _, test := range tests {
+		if got := Match(test.pattern, test.name); got != test.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", test.pattern, test.name, got, test.want)
+		}
+	}
+}
+
+func TestAny(t *testing.T) {
+	patterns := []string{"*.md", "docs/"}
+	for name, want := range map[string]bool{
+		"README.md":     true,
+		"docs/logo.png": true,
+		"main.go":       false,
+	} {
+		if got := Any(patterns, name); got != want {
+			t.Errorf("Any(%q, %q) = %v, want %v", patterns, name, got, want)
+		}
+	}
+	if Any(nil, "main.go") {
+		t.Error("Any without patterns matched")
+	}
+}
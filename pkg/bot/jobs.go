@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dastanng/gitbot/pkg/bot/scheduler"
+)
+
+// periodic jobs
+const (
+	labelSyncJob = "label-sync"
+	lifecycleJob = "lifecycle"
+)
+
+// registerJobs adds every job to the scheduler. Jobs without an interval
+// are only run when they are triggered.
+func (b *Bot) registerJobs() error {
+	jitter := *b.cfg.Jobs.Jitter
+	for _, job := range []scheduler.Job{
+		{Name: labelSyncJob, Interval: b.cfg.LabelSync.Interval, Run: b.labelSyncJob},
+		{Name: lifecycleJob, Interval: b.cfg.Lifecycle.Interval, Run: b.SweepLifecycle},
+	} {
+		job.Jitter = jitter
+		job.Timeout = b.cfg.Jobs.Timeout
+		if err := b.jobs.Register(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jobDone logs the result of a job run
+func jobDone(name string, err error, d time.Duration) {
+	log := log.with("job", name).with("duration", d.String())
+	if err != nil {
+		log.Errorf("job failed: %v", err)
+		return
+	}
+	log.Info("job succeed")
+}
+
+// handleJobs returns the status of every job, e.g. GET /api/jobs
+func (b *Bot) handleJobs(w http.ResponseWriter, r *http.Request, p *principal) error {
+	if err := p.authorize(scopeJobsRead, ""); err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, b.jobs.Status())
+	return nil
+}
+
+// handleRunJob starts a job in the background, e.g. POST /api/jobs/run?name=lifecycle
+func (b *Bot) handleRunJob(w http.ResponseWriter, r *http.Request, p *principal) error {
+	if err := p.authorize(scopeJobsRun, ""); err != nil {
+		return err
+	}
+	name := r.URL.Query().Get("name")
+	switch err := b.jobs.Trigger(name, false); err {
+	case nil:
+	case scheduler.ErrUnknown:
+		return apiErrorf(http.StatusNotFound, "job %q: %v", name, err)
+	case scheduler.ErrRunning:
+		return apiErrorf(http.StatusConflict, "job %q: %v", name, err)
+	default:
+		return err
+	}
+	log.with("job", name).with("principal", p.name).Info("job triggered")
+	writeJSON(w, http.StatusAccepted, map[string]string{name: "started"})
+	return nil
+}
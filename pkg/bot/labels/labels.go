@@ -1,10 +1,14 @@
 package labels
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"strings"
 
-	"github.com/google/go-github/github"
+	"gopkg.in/yaml.v2"
 )
 
 // github labels
@@ -13,20 +17,109 @@ const (
 	WorkInProgress = "do-not-merge/work-in-progress"
 	Approved       = "approved"
 	LGTM           = "lgtm"
+
+	Stale  = "lifecycle/stale"
+	Rotten = "lifecycle/rotten"
+	Frozen = "lifecycle/frozen"
+
+	ReleaseNote       = "release-note"
+	ReleaseNoteNone   = "release-note-none"
+	ReleaseNoteNeeded = "do-not-merge/release-note-label-needed"
+
+	NeedsRebase  = "needs-rebase"
+	DCOSignoffNo = "dco-signoff: no"
+	// SizePrefix prefixes size labels, e.g. size/XS
+	SizePrefix = "size/"
 )
 
-// LoadPresets load preset labels from file
-func LoadPresets() ([]*github.Label, error) {
+// Reserved labels are managed by bot commands, their names can't be changed
+var Reserved = []string{Hold, WorkInProgress, Approved, LGTM, Stale, Rotten, Frozen,
+	ReleaseNote, ReleaseNoteNone, ReleaseNoteNeeded}
 
-	b, err := ioutil.ReadFile("preset_labels.json")
+// Label is the desired state of a repo label
+type Label struct {
+	Name        string `yaml:"name" json:"name"`
+	Color       string `yaml:"color" json:"color"`
+	Description string `yaml:"description" json:"description"`
+	// Previously lists former names of the label. A label with a former
+	// name is renamed, so that issues having it keep the label.
+	Previously []string `yaml:"previously" json:"previously,omitempty"`
+}
+
+// LoadFile reads labels from a json file, or a yaml file for other extensions
+func LoadFile(path string) ([]Label, error) {
+	b, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	var labels []*github.Label
-
-	if err := json.Unmarshal(b, &labels); err != nil {
-		return nil, err
+	var labels []Label
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.DisallowUnknownFields()
+		err = d.Decode(&labels)
+	} else {
+		err = yaml.UnmarshalStrict(b, &labels)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
 	}
 	return labels, nil
 }
+
+// Validate checks that labels are well formed: every label has a name and
+// a valid color, names are unique, and no reserved label is renamed.
+func Validate(labels []Label) error {
+	seen := make(map[string]bool)
+	for _, l := range labels {
+		if len(l.Name) == 0 {
+			return fmt.Errorf("label without name")
+		}
+		if !validColor(l.Color) {
+			return fmt.Errorf("label %s: invalid color %q, want 6 hex digits", l.Name, l.Color)
+		}
+		for _, n := range append([]string{l.Name}, l.Previously...) {
+			if seen[strings.ToLower(n)] {
+				return fmt.Errorf("label %s: duplicate name %s", l.Name, n)
+			}
+			seen[strings.ToLower(n)] = true
+		}
+		for _, p := range l.Previously {
+			if IsReserved(p) {
+				return fmt.Errorf("label %s: reserved label %s can't be renamed", l.Name, p)
+			}
+		}
+	}
+	return nil
+}
+
+// IsReserved returns whether name is a reserved label
+func IsReserved(name string) bool {
+	for _, r := range Reserved {
+		if strings.EqualFold(r, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPluginLabel returns whether name is set by a plugin from the state of
+// pullrequests, e.g. size/M or needs-rebase
+func IsPluginLabel(name string) bool {
+	return strings.EqualFold(name, NeedsRebase) ||
+		strings.EqualFold(name, DCOSignoffNo) ||
+		len(name) > len(SizePrefix) && strings.EqualFold(name[:len(SizePrefix)], SizePrefix)
+}
+
+func validColor(c string) bool {
+	c = strings.TrimPrefix(c, "#")
+	if len(c) != 6 {
+		return false
+	}
+	for _, r := range strings.ToLower(c) {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
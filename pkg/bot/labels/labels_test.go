@@ -0,0 +1,50 @@
+package labels
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels []Label
+		err    string // substring of the error, empty if valid
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			labels: []Label{
+				{Name: "kind/bug", Color: "e11d21"},
+				{Name: "kind/feature", Color: "#C7DEF8", Previously: []string{"enhancement"}},
+			},
+		},
+		{name: "no name", labels: []Label{{Color: "e11d21"}}, err: "without name"},
+		{name: "short color", labels: []Label{{Name: "a", Color: "fff"}}, err: "invalid color"},
+		{name: "not hex", labels: []Label{{Name: "a", Color: "gggggg"}}, err: "invalid color"},
+		{
+			name:   "duplicate name",
+			labels: []Label{{Name: "a", Color: "ffffff"}, {Name: "A", Color: "000000"}},
+			err:    "duplicate name",
+		},
+		{
+			name:   "former name of another label",
+			labels: []Label{{Name: "a", Color: "ffffff"}, {Name: "b", Color: "000000", Previously: []string{"a"}}},
+			err:    "duplicate name",
+		},
+		{
+			name:   "renamed reserved label",
+			labels: []Label{{Name: "hold", Color: "ffffff", Previously: []string{Hold}}},
+			err:    "reserved label",
+		},
+	}
+	for _, test := range tests {
+		err := Validate(test.labels)
+		switch {
+		case len(test.err) == 0 && err != nil:
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		case len(test.err) > 0 && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
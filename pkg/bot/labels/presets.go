@@ -0,0 +1,89 @@
+package labels
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Presets are labels every repo should have. They are layered: a global
+// preset, extended and overridden by an org preset, then by a repo preset.
+type Presets struct {
+	global []Label
+	orgs   map[string][]Label // by lowercase org
+	repos  map[string][]Label // by lowercase owner/repo
+}
+
+// LoadPresets loads the global preset file, and org and repo preset files
+// keyed by org and owner/repo names. Files are json or yaml. The global
+// preset is empty if global is.
+func LoadPresets(global string, orgs, repos map[string]string) (*Presets, error) {
+	p := &Presets{
+		orgs:  make(map[string][]Label),
+		repos: make(map[string][]Label),
+	}
+
+	var err error
+	if len(global) > 0 {
+		if p.global, err = loadLayer(global, false); err != nil {
+			return nil, err
+		}
+	}
+	for org, file := range orgs {
+		if p.orgs[strings.ToLower(org)], err = loadLayer(file, true); err != nil {
+			return nil, fmt.Errorf("org %s: %v", org, err)
+		}
+	}
+	for repo, file := range repos {
+		if !strings.Contains(repo, "/") {
+			return nil, fmt.Errorf("invalid repo %q, want owner/repo", repo)
+		}
+		if p.repos[strings.ToLower(repo)], err = loadLayer(file, true); err != nil {
+			return nil, fmt.Errorf("repo %s: %v", repo, err)
+		}
+	}
+	return p, nil
+}
+
+// loadLayer loads and validates a preset file. Org and repo layers
+// may not override reserved labels, which the bot relies on.
+func loadLayer(file string, override bool) ([]Label, error) {
+	labels, err := LoadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := Validate(labels); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if override {
+		for _, l := range labels {
+			if IsReserved(l.Name) {
+				return nil, fmt.Errorf("%s: reserved label %s can't be overridden", file, l.Name)
+			}
+		}
+	}
+	return labels, nil
+}
+
+// For returns preset labels of owner/repo
+func (p *Presets) For(owner, repo string) []Label {
+	merged := merge(p.global, p.orgs[strings.ToLower(owner)])
+	return merge(merged, p.repos[strings.ToLower(owner+"/"+repo)])
+}
+
+// merge returns base with labels of layer added, or replacing those with the same name
+func merge(base, layer []Label) []Label {
+	if len(layer) == 0 {
+		return base
+	}
+	merged := make([]Label, 0, len(base)+len(layer))
+	index := make(map[string]int)
+	for _, l := range append(append([]Label(nil), base...), layer...) {
+		if i, ok := index[strings.ToLower(l.Name)]; ok {
+			merged[i] = l
+			continue
+		}
+		index[strings.ToLower(l.Name)] = len(merged)
+		merged = append(merged, l)
+	}
+	return merged
+}
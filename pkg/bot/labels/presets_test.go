@@ -0,0 +1,112 @@
+package labels
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writePresets writes preset files named by their keys into a temporary
+// directory, and returns their paths by key
+func writePresets(t *testing.T, files map[string]string) (map[string]string, func()) {
+	dir, err := ioutil.TempDir("", "presets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make(map[string]string)
+	for name, content := range files {
+		path := filepath.Join(dir, strings.Replace(name, "/", "_", -1))
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		paths[name] = path
+	}
+	return paths, func() { os.RemoveAll(dir) }
+}
+
+func TestPresetsFor(t *testing.T) {
+	paths, cleanup := writePresets(t, map[string]string{
+		"global.json": `[
+			{"name": "bug", "color": "e11d21", "description": "Something is broken"},
+			{"name": "lgtm", "color": "15dd18", "description": "Looks good to me"}
+		]`,
+		"org.yaml": `
+- name: Bug
+  color: ee0701
+  description: Org bug
+- name: org-only
+  color: ffffff
+`,
+		"repo.yaml": `
+- name: org-only
+  color: "000000"
+- name: repo-only
+  color: "111111"
+`,
+	})
+	defer cleanup()
+
+	p, err := LoadPresets(paths["global.json"],
+		map[string]string{"Dastanng": paths["org.yaml"]},
+		map[string]string{"dastanng/Gitbot": paths["repo.yaml"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		owner, repo string
+		want        []string // name color
+	}{
+		{"other", "repo", []string{"bug e11d21", "lgtm 15dd18"}},
+		{"dastanng", "other", []string{"Bug ee0701", "lgtm 15dd18", "org-only ffffff"}},
+		{"DASTANNG", "gitbot", []string{"Bug ee0701", "lgtm 15dd18", "org-only 000000", "repo-only 111111"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, l := range p.For(test.owner, test.repo) {
+			got = append(got, l.Name+" "+l.Color)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("For(%s, %s) = %q, want %q", test.owner, test.repo, got, test.want)
+		}
+	}
+}
+
+func TestLoadPresets(t *testing.T) {
+	paths, cleanup := writePresets(t, map[string]string{
+		"labels.yaml":   "- name: bug\n  color: e11d21\n",
+		"reserved.yaml": "- name: lgtm\n  color: e11d21\n",
+		"invalid.yaml":  "- name: bug\n  color: red\n",
+		"unknown.json":  `[{"name": "bug", "color": "e11d21", "colour": "red"}]`,
+	})
+	defer cleanup()
+
+	tests := []struct {
+		name   string
+		global string
+		orgs   map[string]string
+		repos  map[string]string
+		err    string // substring of the error, empty if loaded
+	}{
+		{name: "no global preset"},
+		{name: "global preset", global: paths["labels.yaml"]},
+		{name: "missing global preset", global: paths["labels.yaml"] + ".missing", err: "no such file"},
+		{name: "reserved label in global preset", global: paths["reserved.yaml"]},
+		{name: "reserved label in org preset", orgs: map[string]string{"o": paths["reserved.yaml"]}, err: "can't be overridden"},
+		{name: "invalid label", repos: map[string]string{"o/r": paths["invalid.yaml"]}, err: "invalid color"},
+		{name: "unknown field", global: paths["unknown.json"], err: "unknown field"},
+		{name: "repo without owner", repos: map[string]string{"r": paths["labels.yaml"]}, err: "want owner/repo"},
+	}
+	for _, test := range tests {
+		_, err := LoadPresets(test.global, test.orgs, test.repos)
+		switch {
+		case len(test.err) == 0 && err != nil:
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		case len(test.err) > 0 && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package labels
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// change types
+const (
+	Create = "create"
+	Update = "update"
+	Rename = "rename"
+	// Merge moves issues from a former label to an existing label,
+	// then deletes the former one
+	Merge  = "merge"
+	Delete = "delete"
+)
+
+// Change is one step to make repo labels match desired labels
+type Change struct {
+	Type    string
+	Label   Label         // desired label, empty for Delete
+	Current *github.Label // existing label, nil for Create
+}
+
+func (c Change) String() string {
+	switch c.Type {
+	case Create:
+		return fmt.Sprintf("+ %s (color: %s, description: %q)", c.Label.Name, c.Label.Color, c.Label.Description)
+	case Update:
+		return fmt.Sprintf("~ %s%s", c.Label.Name, diff(c.Current, c.Label))
+	case Rename:
+		return fmt.Sprintf("~ %s -> %s%s", c.Current.GetName(), c.Label.Name, diff(c.Current, c.Label))
+	case Merge:
+		return fmt.Sprintf("~ %s -> %s (merge into existing label)", c.Current.GetName(), c.Label.Name)
+	default:
+		return fmt.Sprintf("- %s", c.Current.GetName())
+	}
+}
+
+func diff(cur *github.Label, l Label) string {
+	var s string
+	if !sameColor(cur.GetColor(), l.Color) {
+		s += fmt.Sprintf(" color: %s -> %s", cur.GetColor(), l.Color)
+	}
+	if cur.GetDescription() != l.Description {
+		s += fmt.Sprintf(" description: %q -> %q", cur.GetDescription(), l.Description)
+	}
+	return s
+}
+
+// Plan returns changes to make current labels match desired labels.
+// Labels which are not desired are deleted only if prune is set, reserved
+// and plugin labels are never deleted.
+func Plan(current []*github.Label, desired []Label, prune bool) []Change {
+	existing := make(map[string]*github.Label, len(current))
+	for _, l := range current {
+		existing[strings.ToLower(l.GetName())] = l
+	}
+
+	var changes []Change
+	known := make(map[string]bool)
+	for _, l := range desired {
+		known[strings.ToLower(l.Name)] = true
+		cur, ok := existing[strings.ToLower(l.Name)]
+
+		for _, p := range l.Previously {
+			known[strings.ToLower(p)] = true
+			old, found := existing[strings.ToLower(p)]
+			if !found {
+				continue
+			}
+			if !ok {
+				// first former label found becomes the desired one
+				changes = append(changes, Change{Type: Rename, Label: l, Current: old})
+				cur, ok = old, true
+				continue
+			}
+			if old != cur {
+				changes = append(changes, Change{Type: Merge, Label: l, Current: old})
+			}
+		}
+
+		switch {
+		case !ok:
+			changes = append(changes, Change{Type: Create, Label: l})
+		case strings.EqualFold(cur.GetName(), l.Name) && !upToDate(cur, l):
+			changes = append(changes, Change{Type: Update, Label: l, Current: cur})
+		}
+	}
+
+	if prune {
+		for _, l := range current {
+			name := l.GetName()
+			if !known[strings.ToLower(name)] && !IsReserved(name) && !IsPluginLabel(name) {
+				changes = append(changes, Change{Type: Delete, Current: l})
+			}
+		}
+	}
+	return changes
+}
+
+func upToDate(cur *github.Label, l Label) bool {
+	return cur.GetName() == l.Name &&
+		sameColor(cur.GetColor(), l.Color) &&
+		cur.GetDescription() == l.Description
+}
+
+func sameColor(a, b string) bool {
+	return strings.EqualFold(strings.TrimPrefix(a, "#"), strings.TrimPrefix(b, "#"))
+}
@@ -0,0 +1,99 @@
+package labels
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func ghLabel(name, color, description string) *github.Label {
+	return &github.Label{Name: github.String(name), Color: github.String(color), Description: github.String(description)}
+}
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		current []*github.Label
+		desired []Label
+		prune   bool
+		want    []string
+	}{
+		{
+			name:    "up to date",
+			current: []*github.Label{ghLabel("bug", "e11d21", "Something is broken")},
+			desired: []Label{{Name: "bug", Color: "#E11D21", Description: "Something is broken"}},
+		},
+		{
+			name:    "create",
+			desired: []Label{{Name: "bug", Color: "e11d21"}},
+			want:    []string{`+ bug (color: e11d21, description: "")`},
+		},
+		{
+			name:    "update color and description",
+			current: []*github.Label{ghLabel("bug", "ffffff", "")},
+			desired: []Label{{Name: "bug", Color: "e11d21", Description: "Broken"}},
+			want:    []string{`~ bug color: ffffff -> e11d21 description: "" -> "Broken"`},
+		},
+		{
+			name:    "update case of name",
+			current: []*github.Label{ghLabel("Bug", "e11d21", "")},
+			desired: []Label{{Name: "bug", Color: "e11d21"}},
+			want:    []string{"~ bug"},
+		},
+		{
+			name:    "rename former label",
+			current: []*github.Label{ghLabel("enhancement", "c7def8", "")},
+			desired: []Label{{Name: "kind/feature", Color: "c7def8", Previously: []string{"enhancement"}}},
+			want:    []string{"~ enhancement -> kind/feature"},
+		},
+		{
+			name:    "merge former label into existing one",
+			current: []*github.Label{ghLabel("kind/feature", "c7def8", ""), ghLabel("enhancement", "c7def8", "")},
+			desired: []Label{{Name: "kind/feature", Color: "c7def8", Previously: []string{"enhancement"}}},
+			want:    []string{"~ enhancement -> kind/feature (merge into existing label)"},
+		},
+		{
+			name:    "merge second former label into the renamed one",
+			current: []*github.Label{ghLabel("enhancement", "c7def8", ""), ghLabel("feature", "c7def8", "")},
+			desired: []Label{{Name: "kind/feature", Color: "c7def8", Previously: []string{"enhancement", "feature"}}},
+			want: []string{
+				"~ enhancement -> kind/feature",
+				"~ feature -> kind/feature (merge into existing label)",
+			},
+		},
+		{
+			name:    "keep unknown labels",
+			current: []*github.Label{ghLabel("custom", "ffffff", "")},
+		},
+		{
+			name:    "prune unknown labels",
+			current: []*github.Label{ghLabel("custom", "ffffff", ""), ghLabel("enhancement", "c7def8", "")},
+			desired: []Label{{Name: "kind/feature", Color: "c7def8", Previously: []string{"enhancement"}}},
+			prune:   true,
+			want:    []string{"~ enhancement -> kind/feature", "- custom"},
+		},
+		{
+			name: "prune keeps reserved and plugin labels",
+			current: []*github.Label{
+				ghLabel("lgtm", "15dd18", ""), ghLabel("do-not-merge/hold", "e11d21", ""),
+				ghLabel("lifecycle/stale", "795548", ""), ghLabel("release-note-none", "c2e0c6", ""),
+				ghLabel("do-not-merge/release-note-label-needed", "e11d21", ""),
+				ghLabel("size/XS", "009900", ""), ghLabel("Size/XXL", "ee0000", ""),
+				ghLabel("needs-rebase", "e11d21", ""), ghLabel("dco-signoff: no", "e11d21", ""),
+				ghLabel("size", "ffffff", ""),
+			},
+			prune: true,
+			want:  []string{"- size"},
+		},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, c := range Plan(test.current, test.desired, test.prune) {
+			got = append(got, c.String())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
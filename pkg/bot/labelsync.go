@@ -0,0 +1,204 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/labels"
+)
+
+// LabelSyncOptions selects repos and desired labels of a label sync
+type LabelSyncOptions struct {
+	// File holds the desired labels, preset labels are used if empty
+	File string
+	// Orgs are synced repo by repo
+	Orgs []string
+	// Repos are owner/repo names
+	Repos []string
+	// Delete removes labels which are not in File
+	Delete bool
+	// DryRun only prints the plan
+	DryRun bool
+	// User runs the sync, changes are audited on behalf of User
+	User string
+}
+
+// SyncLabels makes labels of every selected repo match opts.File, or preset
+// labels of the repo if no file is given. The plan
+// of each repo is written to out before it's applied. Errors of a repo don't
+// stop others from being synced.
+func (b *Bot) SyncLabels(ctx context.Context, opts LabelSyncOptions, out io.Writer) error {
+	desiredOf := b.presets.For
+	if len(opts.File) > 0 {
+		desired, err := labels.LoadFile(opts.File)
+		if err != nil {
+			return err
+		}
+		if err := labels.Validate(desired); err != nil {
+			return err
+		}
+		desiredOf = func(string, string) []labels.Label { return desired }
+	}
+
+	repos, err := b.listRepos(ctx, opts.Orgs, opts.Repos)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, r := range repos {
+		if err := b.syncRepoLabels(ctx, r[0], r[1], desiredOf(r[0], r[1]), opts, out); err != nil {
+			fmt.Fprintf(out, "%s/%s: failed: %v\n", r[0], r[1], err)
+			failed = append(failed, r[0]+"/"+r[1])
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("sync labels failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// labelSyncJob syncs labels as configured
+func (b *Bot) labelSyncJob(ctx context.Context) error {
+	s := b.cfg.LabelSync
+	var out bytes.Buffer
+	err := b.SyncLabels(ctx, LabelSyncOptions{
+		File:   s.File,
+		Orgs:   s.Orgs,
+		Repos:  s.Repos,
+		Delete: s.Delete,
+		User:   "job:" + labelSyncJob,
+	}, &out)
+	log := log.with("job", labelSyncJob)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		log.Info(line)
+	}
+	return err
+}
+
+func (b *Bot) syncRepoLabels(ctx context.Context, owner, repo string, desired []labels.Label, opts LabelSyncOptions, out io.Writer) error {
+	recognized, err := b.getRepoLabels(ctx, owner, repo)
+	if err != nil {
+		return err
+	}
+	current := make([]*github.Label, 0, len(recognized))
+	for _, l := range recognized {
+		current = append(current, l)
+	}
+	sort.Slice(current, func(i, j int) bool {
+		return current[i].GetName() < current[j].GetName()
+	})
+
+	changes := labels.Plan(current, desired, opts.Delete)
+	if len(changes) == 0 {
+		fmt.Fprintf(out, "%s/%s: up to date\n", owner, repo)
+		return nil
+	}
+	fmt.Fprintf(out, "%s/%s:\n", owner, repo)
+	for _, c := range changes {
+		fmt.Fprintf(out, "  %s\n", c)
+	}
+	if opts.DryRun {
+		return nil
+	}
+
+	c := &command{owner: owner, repo: repo, user: opts.User, cmd: "labels sync"}
+	for _, change := range changes {
+		if err := b.applyLabelChange(ctx, c, change); err != nil {
+			return fmt.Errorf("%s: %v", change, err)
+		}
+	}
+	return nil
+}
+
+func (b *Bot) applyLabelChange(ctx context.Context, c *command, change labels.Change) error {
+	desired := &github.Label{
+		Name:        github.String(change.Label.Name),
+		Color:       github.String(strings.TrimPrefix(change.Label.Color, "#")),
+		Description: github.String(change.Label.Description),
+	}
+	switch change.Type {
+	case labels.Create:
+		return b.createLabel(ctx, c, desired)
+	case labels.Update, labels.Rename:
+		// renaming keeps the label on issues
+		return b.editLabel(ctx, c, change.Current.GetName(), desired)
+	case labels.Merge:
+		return b.mergeLabel(ctx, c, change.Current.GetName(), change.Label.Name)
+	default:
+		return b.deleteLabel(ctx, c, change.Current.GetName())
+	}
+}
+
+// mergeLabel adds label to every issue of the repo of c having label from,
+// then deletes from
+func (b *Bot) mergeLabel(ctx context.Context, c *command, from, label string) error {
+	opt := &github.IssueListByRepoOptions{
+		State:       "all",
+		Labels:      []string{from},
+		ListOptions: github.ListOptions{Page: 1, PerPage: 100},
+	}
+	for opt.Page > 0 {
+		issues, resp, err := b.git.Issues.ListByRepo(ctx, c.owner, c.repo, opt)
+		if err != nil {
+			return err
+		}
+		for _, issue := range issues {
+			ic := *c
+			ic.number = issue.GetNumber()
+			if err := b.addLabels(ctx, &ic, label); err != nil {
+				return err
+			}
+		}
+		opt.Page = resp.NextPage
+	}
+	return b.deleteLabel(ctx, c, from)
+}
+
+// listRepos returns owner/repo pairs of repos, together with every repo of orgs
+func (b *Bot) listRepos(ctx context.Context, orgs, repos []string) ([][2]string, error) {
+	var list [][2]string
+	for _, r := range repos {
+		parts := strings.SplitN(r, "/", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return nil, fmt.Errorf("invalid repo %q, want owner/repo", r)
+		}
+		list = append(list, [2]string{parts[0], parts[1]})
+	}
+	for _, org := range orgs {
+		names, err := b.orgRepos(ctx, org)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			list = append(list, [2]string{org, name})
+		}
+	}
+	return list, nil
+}
+
+// orgRepos returns names of all repos of org, archived repos are skipped
+func (b *Bot) orgRepos(ctx context.Context, org string) ([]string, error) {
+	var names []string
+	opt := &github.RepositoryListByOrgOptions{ListOptions: github.ListOptions{Page: 1, PerPage: 100}}
+	for opt.Page > 0 {
+		repos, resp, err := b.git.Repositories.ListByOrg(ctx, org, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range repos {
+			if r.GetArchived() {
+				continue
+			}
+			names = append(names, r.GetName())
+		}
+		opt.Page = resp.NextPage
+	}
+	return names, nil
+}
@@ -0,0 +1,219 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/config"
+	"github.com/dastanng/gitbot/pkg/bot/labels"
+)
+
+// lifecycleSweeper is the command of changes made by the sweeper
+const lifecycleSweeper = "lifecycle sweeper"
+
+var lifecycleLabels = map[string]string{
+	"stale":  labels.Stale,
+	"rotten": labels.Rotten,
+	"frozen": labels.Frozen,
+}
+
+// cmdLifecycle handles command /lifecycle (stale|rotten|frozen) and
+// /remove-lifecycle (stale|rotten|frozen). An issue has at most one
+// lifecycle label, setting one removes the others. As frozen keeps an issue
+// open for good, only its author or collaborators may set or remove it.
+func (b *Bot) cmdLifecycle(ctx context.Context, c *command) error {
+	// check command syntax
+	if len(c.args) != 1 {
+		return c.invalid()
+	}
+	label, ok := lifecycleLabels[strings.ToLower(c.args[0])]
+	if !ok {
+		return c.invalid()
+	}
+
+	if label == labels.Frozen {
+		allowed, err := b.hasRole(ctx, c, []string{roleAuthor, roleCollaborator})
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return c.ignore("user is neither author nor a collaborator")
+		}
+	}
+
+	current, err := b.issueLabels(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	if c.cmd == "/remove-lifecycle" {
+		if !containsFold(current, label) {
+			return nil
+		}
+		return b.removeLabel(ctx, c, label)
+	}
+
+	for _, l := range lifecycleLabels {
+		if l != label && containsFold(current, l) {
+			if err := b.removeLabel(ctx, c, l); err != nil {
+				return err
+			}
+		}
+	}
+	if containsFold(current, label) {
+		return nil
+	}
+	return b.addLabels(ctx, c, label)
+}
+
+// SweepLifecycle marks inactive issues (and pullrequests) of configured repos
+// stale, marks stale ones rotten, and closes rotten ones, explaining each
+// step in a comment. Frozen issues are skipped. Errors of a repo don't stop
+// others from being swept.
+func (b *Bot) SweepLifecycle(ctx context.Context) error {
+	var orgs, names []string
+	for _, r := range b.cfg.Lifecycle.Rules {
+		for _, n := range r.Repos {
+			if strings.Contains(n, "/") {
+				names = append(names, n)
+			} else {
+				orgs = append(orgs, n)
+			}
+		}
+	}
+	repos, err := b.listRepos(ctx, orgs, names)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	swept := make(map[string]bool)
+	for _, r := range repos {
+		name := strings.ToLower(r[0] + "/" + r[1])
+		if swept[name] {
+			continue
+		}
+		swept[name] = true
+		if err := b.sweepRepo(ctx, r[0], r[1], b.cfg.Lifecycle.RuleFor(r[0], r[1])); err != nil {
+			log.with("owner", r[0]).with("repo", r[1]).Errorf("lifecycle sweep failed: %v", err)
+			failed = append(failed, r[0]+"/"+r[1])
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("lifecycle sweep failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (b *Bot) sweepRepo(ctx context.Context, owner, repo string, rule *config.LifecycleRule) error {
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+	opt := &github.IssueListByRepoOptions{
+		State:       "open",
+		Sort:        "updated",
+		Direction:   "asc",
+		ListOptions: github.ListOptions{Page: 1, PerPage: 100},
+	}
+	// the sweeper's own comment and label update a stale (or rotten) issue,
+	// so each step waits for the threshold of its label, the smallest of
+	// which bounds the list
+	minDays := rule.StaleDays
+	for _, d := range []int{rule.RottenDays, rule.CloseDays} {
+		if d < minDays {
+			minDays = d
+		}
+	}
+
+	// list first, issues move to the end of the list once they are updated
+	var inactive []*github.Issue
+	for opt.Page > 0 {
+		issues, resp, err := b.git.Issues.ListByRepo(ctx, owner, repo, opt)
+		if err != nil {
+			return err
+		}
+		for _, issue := range issues {
+			if time.Since(issue.GetUpdatedAt()) < days(minDays) {
+				// sorted by update time, the rest are active
+				opt.Page = 0
+				break
+			}
+			inactive = append(inactive, issue)
+		}
+		if opt.Page > 0 {
+			opt.Page = resp.NextPage
+		}
+	}
+
+	var failed int
+	for _, issue := range inactive {
+		var current []string
+		for _, l := range issue.Labels {
+			current = append(current, l.GetName())
+		}
+		if containsFold(current, labels.Frozen) {
+			continue
+		}
+		idle := time.Since(issue.GetUpdatedAt())
+		c := &command{
+			owner:  owner,
+			repo:   repo,
+			number: issue.GetNumber(),
+			author: issue.User.GetLogin(),
+			cmd:    lifecycleSweeper,
+		}
+
+		var err error
+		switch {
+		case containsFold(current, labels.Rotten):
+			if idle >= days(rule.CloseDays) {
+				err = b.sweepStep(ctx, c, "", "", fmt.Sprintf(
+					"Rotten issues close after %dd of inactivity.\nReopen the issue with `/reopen`.",
+					rule.CloseDays))
+				if err == nil {
+					err = b.editState(ctx, c, "closed")
+				}
+			}
+		case containsFold(current, labels.Stale):
+			if idle >= days(rule.RottenDays) {
+				err = b.sweepStep(ctx, c, labels.Stale, labels.Rotten, fmt.Sprintf(
+					"Stale issues rot after %dd of inactivity.\nMark the issue as fresh with `/remove-lifecycle rotten`.\nRotten issues close after an additional %dd of inactivity.\nIf this issue is safe to close now please do so with `/close`.",
+					rule.RottenDays, rule.CloseDays))
+			}
+		case idle >= days(rule.StaleDays):
+			err = b.sweepStep(ctx, c, "", labels.Stale, fmt.Sprintf(
+				"Issues go stale after %dd of inactivity.\nMark the issue as fresh with `/remove-lifecycle stale`.\nStale issues rot after an additional %dd of inactivity and eventually close.\nIf this issue is safe to close now please do so with `/close`.\nPrevent issues from auto-closing with a `/lifecycle frozen` comment.",
+				rule.StaleDays, rule.RottenDays))
+		}
+		if err != nil {
+			// an issue failing doesn't stop others from being swept
+			c.log().Errorf("lifecycle sweep failed: %v", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d issue(s) failed", failed)
+	}
+	return nil
+}
+
+// sweepStep replaces label from (if any) with label to (if any), and
+// explains why in a comment
+func (b *Bot) sweepStep(ctx context.Context, c *command, from, to, why string) error {
+	if err := b.comment(ctx, c, why); err != nil {
+		return err
+	}
+	if len(from) > 0 {
+		if err := b.removeLabel(ctx, c, from); err != nil {
+			return err
+		}
+	}
+	if len(to) > 0 {
+		if err := b.addLabels(ctx, c, to); err != nil {
+			return err
+		}
+	}
+	c.log().Infof("lifecycle %s -> %s", from, to)
+	return nil
+}
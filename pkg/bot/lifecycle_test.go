@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/audit"
+	"github.com/dastanng/gitbot/pkg/bot/config"
+)
+
+func TestLifecycle(t *testing.T) {
+	ignored := &skippedError{outcome: "ignored", reason: "user is neither author nor a collaborator"}
+	tests := []struct {
+		name   string
+		cmd    string
+		arg    string
+		user   string
+		labels []string
+		err    error
+		want   []string // audited actions
+	}{
+		{name: "stale", cmd: "/lifecycle", arg: "Stale", user: "other", want: []string{"Issues.AddLabelsToIssue"}},
+		{name: "replaces", cmd: "/lifecycle", arg: "rotten", user: "other", labels: []string{"lifecycle/stale"},
+			want: []string{"Issues.RemoveLabelForIssue", "Issues.AddLabelsToIssue"}},
+		{name: "set already", cmd: "/lifecycle", arg: "stale", user: "other", labels: []string{"Lifecycle/Stale"}},
+		{name: "remove", cmd: "/remove-lifecycle", arg: "stale", user: "other", labels: []string{"lifecycle/stale"},
+			want: []string{"Issues.RemoveLabelForIssue"}},
+		{name: "remove missing", cmd: "/remove-lifecycle", arg: "rotten", user: "other"},
+		{name: "unknown", cmd: "/lifecycle", arg: "dead", user: "other", err: &skippedError{outcome: "invalid", reason: "invalid command syntax"}},
+		{name: "frozen by author", cmd: "/lifecycle", arg: "frozen", user: "author", want: []string{"Issues.AddLabelsToIssue"}},
+		{name: "frozen by collaborator", cmd: "/lifecycle", arg: "frozen", user: "collab", want: []string{"Issues.AddLabelsToIssue"}},
+		{name: "frozen by other", cmd: "/lifecycle", arg: "frozen", user: "other", err: ignored},
+		{name: "unfrozen by other", cmd: "/remove-lifecycle", arg: "frozen", user: "other", labels: []string{"lifecycle/frozen"}, err: ignored},
+	}
+	for _, test := range tests {
+		var current []*github.Label
+		for _, l := range test.labels {
+			current = append(current, &github.Label{Name: github.String(l)})
+		}
+		routes := withRoutes(map[string]interface{}{
+			"GET /repos/o/r/issues/1/labels":  current,
+			"POST /repos/o/r/issues/1/labels": current,
+		})
+		for _, l := range lifecycleLabels {
+			routes["DELETE /repos/o/r/issues/1/labels/"+l] = nil
+		}
+		b, _, close := newTestBot(t, routes)
+
+		c := &command{owner: "o", repo: "r", number: 1, author: "author", user: test.user, cmd: test.cmd, args: []string{test.arg}}
+		if err := b.cmdLifecycle(context.Background(), c); !reflect.DeepEqual(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+		if got := auditActions(t, b); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got actions %v, want %v", test.name, got, test.want)
+		}
+		close()
+	}
+}
+
+func TestSweepRepo(t *testing.T) {
+	rule := &config.LifecycleRule{StaleDays: 30, RottenDays: 20, CloseDays: 10}
+	issue := func(number, idleDays int, labels ...string) *github.Issue {
+		updated := time.Now().Add(-time.Duration(idleDays)*24*time.Hour - time.Minute)
+		i := &github.Issue{
+			Number:    github.Int(number),
+			UpdatedAt: &updated,
+			User:      &github.User{Login: github.String("author")},
+		}
+		for _, l := range labels {
+			i.Labels = append(i.Labels, github.Label{Name: github.String(l)})
+		}
+		return i
+	}
+	// least recently updated first, as listed by GitHub
+	issues := []*github.Issue{
+		issue(1, 100, "lifecycle/frozen"),
+		issue(2, 40),
+		issue(3, 25, "Lifecycle/Stale"),
+		issue(4, 25),
+		issue(5, 15, "lifecycle/stale"),
+		issue(6, 12, "lifecycle/rotten"),
+		issue(7, 9, "lifecycle/rotten"),
+		// out of order, the list ends at the first issue active for less
+		// than the smallest threshold
+		issue(8, 50),
+	}
+	routes := map[string]interface{}{"GET /repos/o/r/issues": issues}
+	for n := 1; n <= len(issues); n++ {
+		prefix := fmt.Sprintf("/repos/o/r/issues/%d", n)
+		routes["GET "+prefix] = &github.Issue{State: github.String("open")}
+		routes["PATCH "+prefix] = &github.Issue{}
+		routes["GET "+prefix+"/labels"] = []*github.Label{}
+		routes["POST "+prefix+"/labels"] = []*github.Label{}
+		routes["POST "+prefix+"/comments"] = &github.IssueComment{}
+		routes["DELETE "+prefix+"/labels/lifecycle/stale"] = nil
+	}
+	b, _, close := newTestBot(t, routes)
+	defer close()
+
+	if err := b.sweepRepo(context.Background(), "o", "r", rule); err != nil {
+		t.Fatal(err)
+	}
+	records, err := b.audit.Query(audit.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range records {
+		got = append(got, fmt.Sprintf("%d %s %v", r.Number, r.Action, r.After))
+	}
+	want := []string{
+		"2 Issues.CreateComment []",
+		"2 Issues.AddLabelsToIssue []",
+		"3 Issues.CreateComment []",
+		"3 Issues.RemoveLabelForIssue []",
+		"3 Issues.AddLabelsToIssue []",
+		"6 Issues.CreateComment []",
+		"6 Issues.Edit [closed]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
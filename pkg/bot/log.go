@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+var (
+	// jsonLogs writes one json object per line to jsonOut, stderr, instead
+	// of glog text
+	jsonLogs bool
+	jsonMu   sync.Mutex
+	jsonOut  io.Writer = os.Stderr
+
+	// log is the logger without any context
+	log = &logger{}
+)
+
+// fields carries structured context of a log line
+type fields map[string]interface{}
+
+// logger writes log lines with structured fields attached
+type logger struct {
+	fields fields
+}
+
+// with returns a copy of l with key=value attached
+func (l *logger) with(key string, value interface{}) *logger {
+	f := make(fields, len(l.fields)+1)
+	for k, v := range l.fields {
+		f[k] = v
+	}
+	f[key] = value
+	return &logger{fields: f}
+}
+
+func (l *logger) Info(args ...interface{}) {
+	l.output("info", fmt.Sprint(args...))
+}
+
+func (l *logger) Infof(format string, args ...interface{}) {
+	l.output("info", fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Warningf(format string, args ...interface{}) {
+	l.output("warning", fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Errorf(format string, args ...interface{}) {
+	l.output("error", fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Fatalf(format string, args ...interface{}) {
+	l.output("fatal", fmt.Sprintf(format, args...))
+}
+
+func (l *logger) output(level, msg string) {
+	if jsonLogs {
+		l.outputJSON(level, msg)
+		return
+	}
+
+	const depth = 2 // skip output() and the exported method
+	switch line := l.text(msg); level {
+	case "info":
+		glog.InfoDepth(depth, line)
+	case "warning":
+		glog.WarningDepth(depth, line)
+	case "error":
+		glog.ErrorDepth(depth, line)
+	default:
+		glog.FatalDepth(depth, line)
+	}
+}
+
+// text returns msg followed by the fields as sorted key=value pairs
+func (l *logger) text(msg string) string {
+	var buf bytes.Buffer
+	buf.WriteString(msg)
+	keys := make([]string, 0, len(l.fields))
+	for k := range l.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, " %s=%v", k, l.fields[k])
+	}
+	return buf.String()
+}
+
+func (l *logger) outputJSON(level, msg string) {
+	line := make(map[string]interface{}, len(l.fields)+3)
+	for k, v := range l.fields {
+		line[k] = v
+	}
+	line["time"] = time.Now().Format(time.RFC3339Nano)
+	line["level"] = level
+	line["msg"] = msg
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"level": "error", "msg": err.Error()})
+	}
+
+	jsonMu.Lock()
+	jsonOut.Write(append(b, '\n'))
+	jsonMu.Unlock()
+
+	if level == "fatal" {
+		glog.Flush()
+		os.Exit(255)
+	}
+}
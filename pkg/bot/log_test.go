@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestLoggerWith(t *testing.T) {
+	base := log.with("owner", "o")
+	l := base.with("number", 1).with("owner", "p")
+	if want := (fields{"owner": "o"}); !reflect.DeepEqual(base.fields, want) {
+		t.Errorf("with changed its logger: got %v, want %v", base.fields, want)
+	}
+	if len(log.fields) != 0 {
+		t.Errorf("with changed the root logger: got %v", log.fields)
+	}
+	if got, want := l.text("queued"), "queued number=1 owner=p"; got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(out io.Writer) { jsonLogs, jsonOut = false, out }(jsonOut)
+	jsonLogs, jsonOut = true, &buf
+
+	c := &command{owner: "o", repo: "r", number: 1, user: "alice", cmd: "/kind", args: []string{"bug", "feature"}, delivery: "d1"}
+	c.log().with("outcome", "queued").Infof("command %s", "queued")
+	log.Errorf("failed")
+
+	var lines []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var line map[string]interface{}
+		if err := dec.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := line["time"]; !ok {
+			t.Errorf("no time in %v", line)
+		}
+		delete(line, "time")
+		lines = append(lines, line)
+	}
+	want := []map[string]interface{}{
+		{
+			"level": "info", "msg": "command queued", "outcome": "queued",
+			"delivery": "d1", "event": "", "owner": "o", "repo": "r", "number": float64(1),
+			"author": "", "user": "alice", "command": "/kind", "args": "bug feature",
+		},
+		{"level": "error", "msg": "failed"},
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("got %v, want %v", lines, want)
+	}
+}
@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// cmdMilestone handles command /milestone (<title>|clear). The title is
+// resolved against open milestones of the repo. Only maintainers can use it.
+func (b *Bot) cmdMilestone(ctx context.Context, c *command) error {
+	// check command syntax, a title may contain spaces
+	if len(c.args) == 0 {
+		return c.invalid()
+	}
+	title := strings.Join(c.args, " ")
+
+	isMaintainer, err := b.isMaintainer(ctx, c.owner, c.repo, c.user)
+	if err != nil {
+		return err
+	}
+	if !isMaintainer {
+		return c.ignore("user %s is not a maintainer", c.user)
+	}
+
+	if len(c.args) == 1 && strings.EqualFold(c.args[0], "clear") {
+		return b.setMilestone(ctx, c, nil)
+	}
+
+	milestone, err := b.openMilestone(ctx, c.owner, c.repo, title)
+	if err != nil {
+		return err
+	}
+	if milestone == nil {
+		return c.ignore("milestone %q is not an open milestone", title)
+	}
+	return b.setMilestone(ctx, c, milestone)
+}
+
+// openMilestone returns the open milestone of repo titled title, nil if
+// there's none. Titles are matched case-insensitively.
+func (b *Bot) openMilestone(ctx context.Context, owner, repo, title string) (*github.Milestone, error) {
+	opt := &github.MilestoneListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{Page: 1, PerPage: 100},
+	}
+	for opt.Page > 0 {
+		milestones, resp, err := b.git.Issues.ListMilestones(ctx, owner, repo, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range milestones {
+			if strings.EqualFold(m.GetTitle(), title) {
+				return m, nil
+			}
+		}
+		opt.Page = resp.NextPage
+	}
+	return nil, nil
+}
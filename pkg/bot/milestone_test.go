@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/config"
+)
+
+func TestMilestone(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		user string
+		err  error
+		body string // of the request editing the issue
+	}{
+		{name: "title", args: []string{"v1.0"}, user: "maint", body: `{"milestone":1}`},
+		{name: "spaces", args: []string{"release", "2.0"}, user: "maint", body: `{"milestone":2}`},
+		{name: "clear", args: []string{"Clear"}, user: "maint", body: `{"milestone":null}`},
+		{name: "closed", args: []string{"v0.9"}, user: "maint", err: &skippedError{outcome: "ignored", reason: `milestone "v0.9" is not an open milestone`}},
+		{name: "no title", user: "maint", err: &skippedError{outcome: "invalid", reason: "invalid command syntax"}},
+		{name: "not maintainer", args: []string{"v1.0"}, user: "author", err: &skippedError{outcome: "ignored", reason: "user author is not a maintainer"}},
+	}
+	for _, test := range tests {
+		var body string
+		b, _, close := newTestBot(t, withRoutes(map[string]interface{}{
+			"GET /repos/o/r/milestones": []*github.Milestone{
+				{Number: github.Int(1), Title: github.String("v1.0")},
+				{Number: github.Int(2), Title: github.String("Release 2.0")},
+			},
+			"GET /repos/o/r/issues/1": &github.Issue{},
+			"PATCH /repos/o/r/issues/1": func(r *http.Request) (int, interface{}) {
+				raw, _ := ioutil.ReadAll(r.Body)
+				body = strings.TrimSpace(string(raw))
+				return http.StatusOK, &github.Issue{}
+			},
+		}))
+		b.cfg.Maintainers = []config.Maintainers{{Repos: []string{"o"}, Team: "maint"}}
+
+		c := &command{owner: "o", repo: "r", number: 1, user: test.user, cmd: "/milestone", args: test.args}
+		if err := b.cmdMilestone(context.Background(), c); !reflect.DeepEqual(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+		if body != test.body {
+			t.Errorf("%s: got request %s, want %s", test.name, body, test.body)
+		}
+		close()
+	}
+}
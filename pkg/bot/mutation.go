@@ -0,0 +1,356 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/audit"
+)
+
+// Every change the bot makes to GitHub on behalf of a command goes through
+// the helpers below, so that it is written to the audit log.
+
+// auditRecord builds an audit record of action made by c
+func (c *command) auditRecord(action string, before, after []string) *audit.Record {
+	return &audit.Record{
+		Delivery:   c.delivery,
+		Owner:      c.owner,
+		Repo:       c.repo,
+		Number:     c.number,
+		User:       c.user,
+		CommentURL: c.url,
+		Command:    c.line(),
+		Action:     action,
+		Before:     before,
+		After:      after,
+	}
+}
+
+// record appends r to the audit log. The mutation has already been made,
+// so a failure is logged rather than failing the command.
+func (b *Bot) record(r *audit.Record) {
+	if err := b.audit.Append(r); err != nil {
+		log.with("owner", r.Owner).with("repo", r.Repo).with("number", r.Number).
+			Errorf("append audit record %s err: %v", r.Action, err)
+	}
+}
+
+// issueLabels returns label names of an issue (or pullrequest)
+func (b *Bot) issueLabels(ctx context.Context, owner, repo string, number int) ([]string, error) {
+	var names []string
+	opt := &github.ListOptions{Page: 1, PerPage: 100}
+	for opt.Page > 0 {
+		list, resp, err := b.git.Issues.ListLabelsByIssue(ctx, owner, repo, number, opt)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, labelNames(list)...)
+		opt.Page = resp.NextPage
+	}
+	return names, nil
+}
+
+// addLabels adds labels to the issue of c
+func (b *Bot) addLabels(ctx context.Context, c *command, names ...string) error {
+	before, err := b.issueLabels(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	after, _, err := b.git.Issues.AddLabelsToIssue(ctx, c.owner, c.repo, c.number, names)
+	if err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Issues.AddLabelsToIssue", before, labelNames(after)))
+	return nil
+}
+
+// removeLabel removes a label from the issue of c
+func (b *Bot) removeLabel(ctx context.Context, c *command, name string) error {
+	before, err := b.issueLabels(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	if _, err := b.git.Issues.RemoveLabelForIssue(ctx, c.owner, c.repo, c.number, name); err != nil {
+		return err
+	}
+	var after []string
+	for _, l := range before {
+		if !strings.EqualFold(l, name) {
+			after = append(after, l)
+		}
+	}
+	b.record(c.auditRecord("Issues.RemoveLabelForIssue", before, after))
+	return nil
+}
+
+// editState opens or closes the issue of c
+func (b *Bot) editState(ctx context.Context, c *command, state string) error {
+	issue, _, err := b.git.Issues.Get(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	if _, _, err := b.git.Issues.Edit(ctx, c.owner, c.repo, c.number, &github.IssueRequest{State: &state}); err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Issues.Edit", []string{issue.GetState()}, []string{state}))
+	return nil
+}
+
+// editTitle retitles the issue of c
+func (b *Bot) editTitle(ctx context.Context, c *command, title string) error {
+	issue, _, err := b.git.Issues.Get(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	if _, _, err := b.git.Issues.Edit(ctx, c.owner, c.repo, c.number, &github.IssueRequest{Title: &title}); err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Issues.Edit", []string{issue.GetTitle()}, []string{title}))
+	return nil
+}
+
+// lock locks the conversation of the issue of c, reason may be empty
+func (b *Bot) lock(ctx context.Context, c *command, reason string) error {
+	if _, err := b.git.Issues.Lock(ctx, c.owner, c.repo, c.number, &github.LockIssueOptions{LockReason: reason}); err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Issues.Lock", []string{"unlocked"}, []string{strings.TrimSpace("locked " + reason)}))
+	return nil
+}
+
+// unlock unlocks the conversation of the issue of c
+func (b *Bot) unlock(ctx context.Context, c *command) error {
+	if _, err := b.git.Issues.Unlock(ctx, c.owner, c.repo, c.number); err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Issues.Unlock", []string{"locked"}, []string{"unlocked"}))
+	return nil
+}
+
+// addAssignees assigns users to the issue of c
+func (b *Bot) addAssignees(ctx context.Context, c *command, users []string) error {
+	issue, _, err := b.git.Issues.Get(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	after, _, err := b.git.Issues.AddAssignees(ctx, c.owner, c.repo, c.number, users)
+	if err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Issues.AddAssignees", userLogins(issue.Assignees), userLogins(after.Assignees)))
+	return nil
+}
+
+// removeAssignees unassigns users from the issue of c
+func (b *Bot) removeAssignees(ctx context.Context, c *command, users []string) error {
+	issue, _, err := b.git.Issues.Get(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	after, _, err := b.git.Issues.RemoveAssignees(ctx, c.owner, c.repo, c.number, users)
+	if err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Issues.RemoveAssignees", userLogins(issue.Assignees), userLogins(after.Assignees)))
+	return nil
+}
+
+// requestReviewers requests reviews from users on the pullrequest of c
+func (b *Bot) requestReviewers(ctx context.Context, c *command, users []string) error {
+	pr, _, err := b.git.PullRequests.RequestReviewers(ctx, c.owner, c.repo, c.number, github.ReviewersRequest{Reviewers: users})
+	if err != nil {
+		return err
+	}
+	b.record(c.auditRecord("PullRequests.RequestReviewers", nil, userLogins(pr.RequestedReviewers)))
+	return nil
+}
+
+// removeReviewers removes review requests of users from the pullrequest of c
+func (b *Bot) removeReviewers(ctx context.Context, c *command, users []string) error {
+	if _, err := b.git.PullRequests.RemoveReviewers(ctx, c.owner, c.repo, c.number, github.ReviewersRequest{Reviewers: users}); err != nil {
+		return err
+	}
+	b.record(c.auditRecord("PullRequests.RemoveReviewers", users, nil))
+	return nil
+}
+
+// comment replies to the issue of c
+func (b *Bot) comment(ctx context.Context, c *command, body string) error {
+	comment, _, err := b.git.Issues.CreateComment(ctx, c.owner, c.repo, c.number, &github.IssueComment{Body: &body})
+	if err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Issues.CreateComment", nil, []string{comment.GetHTMLURL()}))
+	return nil
+}
+
+// setMilestone sets the milestone of the issue of c, or clears it if m is nil
+func (b *Bot) setMilestone(ctx context.Context, c *command, m *github.Milestone) error {
+	issue, _, err := b.git.Issues.Get(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	// IssueRequest omits a nil milestone, so clearing needs an explicit null
+	body := struct {
+		Milestone *int `json:"milestone"`
+	}{}
+	var after []string
+	if m != nil {
+		body.Milestone = m.Number
+		after = []string{m.GetTitle()}
+	}
+	req, err := b.git.NewRequest("PATCH", fmt.Sprintf("repos/%v/%v/issues/%d", c.owner, c.repo, c.number), body)
+	if err != nil {
+		return err
+	}
+	if _, err := b.git.Do(ctx, req, nil); err != nil {
+		return err
+	}
+	var before []string
+	if issue.Milestone != nil {
+		before = []string{issue.Milestone.GetTitle()}
+	}
+	b.record(c.auditRecord("Issues.Edit", before, after))
+	return nil
+}
+
+// rerequestCheckSuite reruns every check run of a check suite
+func (b *Bot) rerequestCheckSuite(ctx context.Context, c *command, id int64) error {
+	if _, err := b.git.Checks.ReRequestCheckSuite(ctx, c.owner, c.repo, id); err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Checks.ReRequestCheckSuite", nil, []string{fmt.Sprint(id)}))
+	return nil
+}
+
+// rerequestCheckRun reruns a check run, which the vendored client lacks
+func (b *Bot) rerequestCheckRun(ctx context.Context, c *command, id int64, name string) error {
+	u := fmt.Sprintf("repos/%v/%v/check-runs/%v/rerequest", c.owner, c.repo, id)
+	req, err := b.git.NewRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github.antiope-preview+json")
+	if _, err := b.git.Do(ctx, req, nil); err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Checks.ReRequestCheckRun", nil, []string{name}))
+	return nil
+}
+
+// createStatus sets a commit status of sha on the repo of c
+func (b *Bot) createStatus(ctx context.Context, c *command, sha string, status *github.RepoStatus) error {
+	if _, _, err := b.git.Repositories.CreateStatus(ctx, c.owner, c.repo, sha, status); err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Repositories.CreateStatus", nil, []string{status.GetContext() + ":" + status.GetState()}))
+	return nil
+}
+
+// createCheckRun reports a check run on the repo of c
+func (b *Bot) createCheckRun(ctx context.Context, c *command, opt github.CreateCheckRunOptions) error {
+	if _, _, err := b.git.Checks.CreateCheckRun(ctx, c.owner, c.repo, opt); err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Checks.CreateCheckRun", nil, []string{opt.Name + ":" + opt.GetConclusion()}))
+	return nil
+}
+
+// createTree creates a tree changing files of baseTree in the repo of c,
+// which the vendored client can't do for deleted files
+func (b *Bot) createTree(ctx context.Context, c *command, baseTree string, entries []treeChange) (*github.Tree, error) {
+	body := struct {
+		BaseTree string       `json:"base_tree"`
+		Tree     []treeChange `json:"tree"`
+	}{baseTree, entries}
+	req, err := b.git.NewRequest("POST", fmt.Sprintf("repos/%v/%v/git/trees", c.owner, c.repo), body)
+	if err != nil {
+		return nil, err
+	}
+	tree := new(github.Tree)
+	if _, err := b.git.Do(ctx, req, tree); err != nil {
+		return nil, err
+	}
+	b.record(c.auditRecord("Git.CreateTree", []string{baseTree}, []string{tree.GetSHA()}))
+	return tree, nil
+}
+
+// createCommit creates commit in the repo of c
+func (b *Bot) createCommit(ctx context.Context, c *command, commit *github.Commit) (*github.Commit, error) {
+	created, _, err := b.git.Git.CreateCommit(ctx, c.owner, c.repo, commit)
+	if err != nil {
+		return nil, err
+	}
+	b.record(c.auditRecord("Git.CreateCommit", nil, []string{created.GetSHA()}))
+	return created, nil
+}
+
+// createBranch creates branch of the repo of c at sha
+func (b *Bot) createBranch(ctx context.Context, c *command, branch, sha string) error {
+	ref := &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: github.String(sha)},
+	}
+	if _, _, err := b.git.Git.CreateRef(ctx, c.owner, c.repo, ref); err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Git.CreateRef", nil, []string{branch + "@" + sha}))
+	return nil
+}
+
+// createLabel creates label l in the repo of c
+func (b *Bot) createLabel(ctx context.Context, c *command, l *github.Label) error {
+	if _, _, err := b.git.Issues.CreateLabel(ctx, c.owner, c.repo, l); err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Issues.CreateLabel", nil, []string{l.GetName()}))
+	return nil
+}
+
+// editLabel changes label name of the repo of c to l. A renamed label is
+// kept on issues.
+func (b *Bot) editLabel(ctx context.Context, c *command, name string, l *github.Label) error {
+	if _, _, err := b.git.Issues.EditLabel(ctx, c.owner, c.repo, name, l); err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Issues.EditLabel", []string{name}, []string{l.GetName()}))
+	return nil
+}
+
+// deleteLabel deletes label name from the repo of c
+func (b *Bot) deleteLabel(ctx context.Context, c *command, name string) error {
+	if _, err := b.git.Issues.DeleteLabel(ctx, c.owner, c.repo, name); err != nil {
+		return err
+	}
+	b.record(c.auditRecord("Issues.DeleteLabel", []string{name}, nil))
+	return nil
+}
+
+// createPullRequest opens a pullrequest on the repo of c
+func (b *Bot) createPullRequest(ctx context.Context, c *command, pr *github.NewPullRequest) (*github.PullRequest, error) {
+	created, _, err := b.git.PullRequests.Create(ctx, c.owner, c.repo, pr)
+	if err != nil {
+		return nil, err
+	}
+	b.record(c.auditRecord("PullRequests.Create", nil, []string{created.GetHTMLURL()}))
+	return created, nil
+}
+
+func labelNames(labels []*github.Label) []string {
+	names := make([]string, 0, len(labels))
+	for _, l := range labels {
+		names = append(names, l.GetName())
+	}
+	return names
+}
+
+func userLogins(users []*github.User) []string {
+	logins := make([]string, 0, len(users))
+	for _, u := range users {
+		logins = append(logins, u.GetLogin())
+	}
+	return logins
+}
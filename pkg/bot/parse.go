@@ -0,0 +1,149 @@
+package bot
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// cmdName matches command names such as /kind or /remove-area
+var cmdName = regexp.MustCompile(`^/[A-Za-z0-9][\w-]*$`)
+
+// parseCommentBody finds commands in a comment. A command is a line starting
+// with "/", it may appear on any line of the comment. Lines inside fenced code
+// blocks, inline code and quoted replies ("> ...") are skipped, while inline
+// code in the arguments of a command is kept, e.g. /retitle Fix `nil` deref.
+// Command names are matched case-insensitively.
+func parseCommentBody(comment string) []*command {
+	var (
+		cmds  []*command
+		fence string // opening fence of the code block we are in
+	)
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+
+		// skip fenced code blocks
+		if len(fence) > 0 {
+			if strings.HasPrefix(line, fence) && len(strings.Trim(line, fence[:1])) == 0 {
+				fence = ""
+			}
+			continue
+		}
+		if f := codeFence(line); len(f) > 0 {
+			fence = f
+			continue
+		}
+
+		// skip quoted replies
+		if strings.HasPrefix(line, ">") {
+			continue
+		}
+
+		// inline code only decides whether the line is a command
+		if !strings.HasPrefix(strings.TrimSpace(stripInlineCode(line)), "/") {
+			continue
+		}
+
+		fields := splitArgs(line)
+		if len(fields) == 0 || !cmdName.MatchString(fields[0]) {
+			continue
+		}
+		cmds = append(cmds, &command{
+			cmd:  strings.ToLower(fields[0]),
+			args: fields[1:],
+			raw:  line,
+		})
+	}
+	return cmds
+}
+
+// codeFence returns the fence if line opens a fenced code block, e.g. ```go
+func codeFence(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// stripInlineCode removes markdown code spans, e.g. `/lgtm`.
+// A span is closed by a backtick run of the same length as the opening one.
+func stripInlineCode(line string) string {
+	var out strings.Builder
+	for i := 0; i < len(line); {
+		if line[i] != '`' {
+			out.WriteByte(line[i])
+			i++
+			continue
+		}
+		n := len(line[i:]) - len(strings.TrimLeft(line[i:], "`"))
+		end := closingTicks(line[i+n:], n)
+		if end < 0 {
+			// unmatched backticks are literal
+			out.WriteString(line[i : i+n])
+			i += n
+			continue
+		}
+		i += n + end + n
+	}
+	return out.String()
+}
+
+// closingTicks returns the index of the first run of exactly n backticks in s
+func closingTicks(s string, n int) int {
+	for i := 0; i < len(s); {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		m := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+		if m == n {
+			return i
+		}
+		i += m
+	}
+	return -1
+}
+
+// splitArgs splits line on runs of whitespace. Arguments may be quoted with
+// double or single quotes to contain whitespace, e.g. /retitle "new title".
+// A quote inside an argument is literal, e.g. /retitle don't merge.
+func splitArgs(line string) []string {
+	var (
+		args    []string
+		arg     []rune
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg = append(arg, r)
+			escaped = false
+		case quote != 0 && r == '\\' && quote == '"':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg = append(arg, r)
+		case !inArg && (r == '"' || r == '\''):
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, string(arg))
+				arg, inArg = arg[:0], false
+			}
+		default:
+			arg = append(arg, r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, string(arg))
+	}
+	return args
+}
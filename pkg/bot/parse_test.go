@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommentBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string // command followed by its args, one entry per command
+	}{
+		{name: "empty", body: ""},
+		{name: "plain text", body: "looks good to me"},
+		{name: "command", body: "/lgtm", want: []string{"/lgtm"}},
+		{name: "args", body: "/kind bug feature", want: []string{"/kind bug feature"}},
+		{name: "case-insensitive name", body: "/LGTM Cancel", want: []string{"/lgtm Cancel"}},
+		{name: "indented", body: "  /hold  ", want: []string{"/hold"}},
+		{name: "any line", body: "thanks!\n/approve\r\n/hold cancel", want: []string{"/approve", "/hold cancel"}},
+		{name: "mid line", body: "please /lgtm"},
+		{name: "path", body: "//lgtm"},
+		{name: "bare slash", body: "/"},
+		{name: "quoted reply", body: "> /close\n/reopen", want: []string{"/reopen"}},
+		{name: "fenced code", body: "```\n/close\n```\n/lgtm", want: []string{"/lgtm"}},
+		{name: "tilde fence", body: "~~~sh\n/close\n~~~\n/lgtm", want: []string{"/lgtm"}},
+		{name: "longer fence", body: "````\n```\n/close\n```\n````\n/lgtm", want: []string{"/lgtm"}},
+		{name: "unclosed fence", body: "```\n/close"},
+		{name: "inline code", body: "`/close`"},
+		{name: "inline code in args", body: "/retitle Fix `nil` deref", want: []string{"/retitle Fix `nil` deref"}},
+		{name: "quoted arg", body: `/retitle "a new title"`, want: []string{"/retitle a new title"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, c := range parseCommentBody(test.body) {
+			got = append(got, c.line())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: parseCommentBody(%q) = %q, want %q", test.name, test.body, got, test.want)
+		}
+	}
+}
+
+func TestStripInlineCode(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"no code", "no code"},
+		{"`/lgtm`", ""},
+		{"a `b` c", "a  c"},
+		{"``a ` b`` c", " c"},
+		{"`unmatched", "`unmatched"},
+		{"``a` b", "``a` b"},
+		{"`a` and `b`", " and "},
+	}
+	for _, test := range tests {
+		if got := stripInlineCode(test.line); got != test.want {
+			t.Errorf("stripInlineCode(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"/lgtm", []string{"/lgtm"}},
+		{"/kind  bug\tfeature", []string{"/kind", "bug", "feature"}},
+		{`/retitle "new title"`, []string{"/retitle", "new title"}},
+		{`/retitle 'new title'`, []string{"/retitle", "new title"}},
+		{`/retitle don't merge`, []string{"/retitle", "don't", "merge"}},
+		{`/retitle "say \"hi\""`, []string{"/retitle", `say "hi"`}},
+		{`/retitle 'a \ b'`, []string{"/retitle", `a \ b`}},
+		{`/retitle ""`, []string{"/retitle", ""}},
+		{`/retitle "unclosed quote`, []string{"/retitle", "unclosed quote"}},
+	}
+	for _, test := range tests {
+		if got := splitArgs(test.line); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
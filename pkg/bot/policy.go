@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/config"
+)
+
+const (
+	// policyCheckRun is the name of the check run of policy checks
+	policyCheckRun = "policy"
+	// maxAnnotations is the number of annotations GitHub takes per request
+	maxAnnotations = 50
+	// policyPath is the path of annotations, which must have one even if
+	// they aren't about a file. They are shown on the check run page.
+	policyPath = ".github"
+)
+
+// violation is a failed policy check
+type violation struct {
+	check    string // e.g. title
+	message  string
+	blocking bool
+}
+
+// cmdPolicy checks the title, commit subjects and head branch name of the
+// pullrequest of c against the policy of its repo, and reports violations
+// as annotations of a check run. The check run fails on a blocking
+// violation, and is neutral if there are only warnings. Only GitHub Apps
+// may create check runs, with a token the result is reported as a commit
+// status instead.
+func (b *Bot) cmdPolicy(ctx context.Context, c *command) error {
+	e, ok := c.event.(*github.PullRequestEvent)
+	if !ok {
+		return c.invalid()
+	}
+	rule := b.cfg.Policy.RuleFor(c.owner, c.repo)
+	if rule == nil {
+		return c.ignore("no policy configured")
+	}
+	pr := e.PullRequest
+
+	var violations []violation
+	check := func(name string, p *config.PolicyCheck, text string) error {
+		v, err := checkPolicy(name, p, text)
+		if err != nil {
+			return err
+		}
+		violations = append(violations, v...)
+		return nil
+	}
+	if err := check("title", &rule.Title, pr.GetTitle()); err != nil {
+		return err
+	}
+	if err := check("branch", &rule.Branch, pr.Head.GetRef()); err != nil {
+		return err
+	}
+	if rule.CommitSubject.Enabled() {
+		commits, err := b.prCommits(ctx, c.owner, c.repo, c.number)
+		if err != nil {
+			return err
+		}
+		for _, rc := range commits {
+			// merge commits, e.g. of the base branch, are made by tools
+			if len(rc.Parents) > 1 {
+				continue
+			}
+			subject := strings.TrimSpace(strings.SplitN(rc.Commit.GetMessage(), "\n", 2)[0])
+			if err := check("commit "+shortSHA(rc.GetSHA()), &rule.CommitSubject, subject); err != nil {
+				return err
+			}
+		}
+	}
+
+	conclusion, title := "success", "All policy checks passed"
+	var blocking int
+	for _, v := range violations {
+		if v.blocking {
+			blocking++
+		}
+	}
+	switch {
+	case blocking > 0:
+		conclusion, title = "failure", fmt.Sprintf("%d blocking violation(s)", blocking)
+	case len(violations) > 0:
+		conclusion, title = "neutral", fmt.Sprintf("%d warning(s)", len(violations))
+	}
+
+	var annotations []*github.CheckRunAnnotation
+	for _, v := range violations {
+		if len(annotations) == maxAnnotations {
+			break
+		}
+		level := "warning"
+		if v.blocking {
+			level = "failure"
+		}
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			Path:            github.String(policyPath),
+			StartLine:       github.Int(1),
+			EndLine:         github.Int(1),
+			AnnotationLevel: github.String(level),
+			Title:           github.String(v.check),
+			Message:         github.String(v.message),
+		})
+	}
+
+	opt := github.CreateCheckRunOptions{
+		Name:        policyCheckRun,
+		HeadBranch:  pr.Head.GetRef(),
+		HeadSHA:     pr.Head.GetSHA(),
+		Status:      github.String("completed"),
+		Conclusion:  github.String(conclusion),
+		CompletedAt: &github.Timestamp{Time: time.Now()},
+		Output: &github.CheckRunOutput{
+			Title:       github.String(title),
+			Summary:     github.String(policySummary(violations)),
+			Annotations: annotations,
+		},
+	}
+	err := b.createCheckRun(ctx, c, opt)
+	if isForbidden(err) {
+		err = b.createStatus(ctx, c, pr.Head.GetSHA(), policyStatus(conclusion, title, violations))
+	}
+	if err != nil {
+		return err
+	}
+	c.log().Infof("policy %s, %d violation(s)", conclusion, len(violations))
+	return nil
+}
+
+// policyStatus is the commit status reporting a check run conclusion. A
+// status has no room for annotations, its description tells the first
+// violation.
+func policyStatus(conclusion, title string, violations []violation) *github.RepoStatus {
+	state := "success"
+	if conclusion == "failure" {
+		state = "failure"
+	}
+	description := title
+	if len(violations) > 0 {
+		v := violations[0]
+		for _, w := range violations {
+			if w.blocking {
+				v = w
+				break
+			}
+		}
+		description = fmt.Sprintf("%s, first: %s: %s", title, v.check, v.message)
+	}
+	// GitHub takes at most 140 characters
+	if r := []rune(description); len(r) > 140 {
+		description = string(r[:139]) + "…"
+	}
+	return &github.RepoStatus{
+		State:       github.String(state),
+		Description: github.String(description),
+		Context:     github.String(policyCheckRun),
+	}
+}
+
+// checkPolicy returns violations of p by text, named check
+func checkPolicy(check string, p *config.PolicyCheck, text string) ([]violation, error) {
+	var violations []violation
+	if len(p.Pattern) > 0 {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, permanent(err)
+		}
+		if !re.MatchString(text) {
+			violations = append(violations, violation{
+				check:    check,
+				message:  fmt.Sprintf("%q doesn't match %s", text, p.Pattern),
+				blocking: p.Blocking,
+			})
+		}
+	}
+	if n := utf8.RuneCountInString(text); p.MaxLength > 0 && n > p.MaxLength {
+		violations = append(violations, violation{
+			check:    check,
+			message:  fmt.Sprintf("%q is %d characters long, at most %d are allowed", text, n, p.MaxLength),
+			blocking: p.Blocking,
+		})
+	}
+	return violations, nil
+}
+
+// policySummary lists violations as markdown
+func policySummary(violations []violation) string {
+	if len(violations) == 0 {
+		return "The title, commit subjects and branch name follow the policy of this repository."
+	}
+	var buf bytes.Buffer
+	for _, v := range violations {
+		level := "warning"
+		if v.blocking {
+			level = "blocking"
+		}
+		fmt.Fprintf(&buf, "- **%s** (%s): %s\n", v.check, level, v.message)
+	}
+	return buf.String()
+}
+
+// shortSHA abbreviates a commit sha as git does
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// validatePolicies checks patterns of policy rules
+func (b *Bot) validatePolicies() error {
+	for _, r := range b.cfg.Policy.Rules {
+		for _, p := range []string{r.Title.Pattern, r.CommitSubject.Pattern, r.Branch.Pattern} {
+			if _, err := regexp.Compile(p); err != nil {
+				return fmt.Errorf("policy of %s: %v", strings.Join(r.Repos, ", "), err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/dastanng/gitbot/pkg/bot/config"
+)
+
+func TestCheckPolicy(t *testing.T) {
+	conventional := `^(feat|fix|docs|chore)(\(.+\))?: .+`
+	tests := []struct {
+		name   string
+		policy config.PolicyCheck
+		text   string
+		want   []string // messages of violations
+	}{
+		{name: "disabled", text: "anything goes"},
+		{name: "matches", policy: config.PolicyCheck{Pattern: conventional}, text: "fix(queue): drop idle tenants"},
+		{
+			name:   "doesn't match",
+			policy: config.PolicyCheck{Pattern: conventional},
+			text:   "Fix the queue",
+			want:   []string{`"Fix the queue" doesn't match ` + conventional},
+		},
+		{name: "short enough", policy: config.PolicyCheck{MaxLength: 10}, text: "fix: queue"},
+		{
+			name:   "too long",
+			policy: config.PolicyCheck{MaxLength: 10},
+			text:   "fix: queues",
+			want:   []string{`"fix: queues" is 11 characters long, at most 10 are allowed`},
+		},
+		{name: "counts characters", policy: config.PolicyCheck{MaxLength: 10}, text: "fix: ünïcø"},
+		{
+			name:   "both",
+			policy: config.PolicyCheck{Pattern: conventional, MaxLength: 5},
+			text:   "update",
+			want: []string{
+				`"update" doesn't match ` + conventional,
+				`"update" is 6 characters long, at most 5 are allowed`,
+			},
+		},
+	}
+	for _, test := range tests {
+		violations, err := checkPolicy("title", &test.policy, test.text)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if len(violations) != len(test.want) {
+			t.Errorf("%s: got %d violation(s) %v, want %d", test.name, len(violations), violations, len(test.want))
+			continue
+		}
+		for i, v := range violations {
+			if v.message != test.want[i] || v.check != "title" || v.blocking != test.policy.Blocking {
+				t.Errorf("%s: got violation %+v, want message %q", test.name, v, test.want[i])
+			}
+		}
+	}
+}
+
+func TestCheckPolicyInvalidPattern(t *testing.T) {
+	_, err := checkPolicy("title", &config.PolicyCheck{Pattern: "("}, "fix: x")
+	if err == nil || isRetryable(err) {
+		t.Errorf("got error %v, want a permanent one", err)
+	}
+}
+
+func TestPolicyStatus(t *testing.T) {
+	warning := violation{check: "branch", message: "branch name is too long"}
+	blocking := violation{check: "title", message: "title doesn't match", blocking: true}
+	tests := []struct {
+		name        string
+		conclusion  string
+		violations  []violation
+		state       string
+		description string
+	}{
+		{"success", "success", nil, "success", "All policy checks passed"},
+		{"warnings pass", "neutral", []violation{warning}, "success", "1 warning(s), first: branch: branch name is too long"},
+		{"blocking first", "failure", []violation{warning, blocking}, "failure", "1 blocking violation(s), first: title: title doesn't match"},
+	}
+	for _, test := range tests {
+		title := strings.SplitN(test.description, ",", 2)[0]
+		s := policyStatus(test.conclusion, title, test.violations)
+		if s.GetState() != test.state || s.GetDescription() != test.description || s.GetContext() != policyCheckRun {
+			t.Errorf("%s: got %s %q (%s), want %s %q", test.name, s.GetState(), s.GetDescription(), s.GetContext(), test.state, test.description)
+		}
+	}
+
+	long := violation{check: "title", message: strings.Repeat("ü", 200), blocking: true}
+	s := policyStatus("failure", "1 blocking violation(s)", []violation{long})
+	if n := utf8.RuneCountInString(s.GetDescription()); n != 140 {
+		t.Errorf("description is %d characters long, want 140", n)
+	}
+	if !utf8.ValidString(s.GetDescription()) {
+		t.Errorf("description %q is not valid utf-8", s.GetDescription())
+	}
+}
@@ -0,0 +1,302 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// ErrFull is returned by Add when the queue reaches its capacity
+var ErrFull = errors.New("queue is full")
+
+// Tenant is a key of items, with its weight and concurrency cap
+type Tenant struct {
+	Key         string
+	Weight      int
+	Concurrency int
+}
+
+// TenantFunc returns the group of an item, e.g. an org, and its tenant
+// within the group, e.g. a repo of the org. Tenant keys are unique within
+// a group.
+type TenantFunc func(item interface{}) (group, tenant Tenant)
+
+// FairQueue is a two-level weighted fair queue. Items are grouped by tenant
+// and tenants by group. Groups are served in proportion to their weights,
+// and the tenants of a group in proportion to theirs within the share of
+// the group, so a flood of items from one tenant (or group) does not starve
+// others. Neither a group nor a tenant ever has more items in process than
+// its concurrency cap.
+type FairQueue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	tenantOf TenantFunc
+	limiter  workqueue.RateLimiter
+	capacity int
+
+	groups map[string]*group
+	// owner tracks which tenant an item in process belongs to
+	owner map[interface{}]*tenant
+	// pending is the number of items waiting to be processed
+	pending int
+	// vtime is the virtual time of the last served group
+	vtime float64
+
+	shuttingDown bool
+}
+
+type group struct {
+	key         string
+	weight      int
+	concurrency int
+
+	tenants  map[string]*tenant
+	pending  int
+	inflight int
+	// finish is the virtual time at which the group's next item finishes
+	finish float64
+	// vtime is the virtual time of the last served tenant of the group
+	vtime float64
+}
+
+type tenant struct {
+	key         string
+	weight      int
+	concurrency int
+	group       *group
+
+	items    []interface{}
+	inflight int
+	// finish is the virtual time at which the tenant's next item finishes
+	finish float64
+}
+
+// NewFairQueue creates a FairQueue holding at most capacity pending items.
+// limiter decides the delay of AddRateLimited.
+func NewFairQueue(capacity int, tenantOf TenantFunc, limiter workqueue.RateLimiter) *FairQueue {
+	q := &FairQueue{
+		tenantOf: tenantOf,
+		limiter:  limiter,
+		capacity: capacity,
+		groups:   make(map[string]*group),
+		owner:    make(map[interface{}]*tenant),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Add adds items to the queue. Either all items are added, or none of
+// them is and ErrFull is returned.
+func (q *FairQueue) Add(items ...interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.shuttingDown {
+		return nil
+	}
+	if q.pending+len(items) > q.capacity {
+		return ErrFull
+	}
+	for _, item := range items {
+		q.push(item)
+	}
+	return nil
+}
+
+// AddSome adds as many of items as the queue has room for, in order, and
+// returns how many are added.
+func (q *FairQueue) AddSome(items ...interface{}) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.shuttingDown {
+		return len(items)
+	}
+	n := q.capacity - q.pending
+	if n > len(items) {
+		n = len(items)
+	}
+	for _, item := range items[:n] {
+		q.push(item)
+	}
+	return n
+}
+
+// AddRateLimited adds item back after the limiter says it's ok.
+// Retried items are always accepted, regardless of capacity.
+func (q *FairQueue) AddRateLimited(item interface{}) {
+	time.AfterFunc(q.limiter.When(item), func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.shuttingDown {
+			return
+		}
+		q.push(item)
+	})
+}
+
+// Forget indicates that an item is finished being retried.
+func (q *FairQueue) Forget(item interface{}) {
+	q.limiter.Forget(item)
+}
+
+// NumRequeues returns how many times the item was requeued.
+func (q *FairQueue) NumRequeues(item interface{}) int {
+	return q.limiter.NumRequeues(item)
+}
+
+// Get blocks until an item can be processed, picking the group with the
+// earliest virtual finish time among those under their concurrency cap,
+// and the tenant of the group picked alike. shutdown is true once ShutDown
+// is called.
+func (q *FairQueue) Get() (item interface{}, shutdown bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.shuttingDown {
+			return nil, true
+		}
+		if t := q.next(); t != nil {
+			g := t.group
+			item = t.items[0]
+			t.items[0] = nil
+			t.items = t.items[1:]
+			t.inflight++
+			g.inflight++
+			g.pending--
+			q.pending--
+			if g.finish > q.vtime {
+				q.vtime = g.finish
+			}
+			g.finish += 1 / float64(g.weight)
+			if t.finish > g.vtime {
+				g.vtime = t.finish
+			}
+			t.finish += 1 / float64(t.weight)
+			q.owner[item] = t
+			return item, false
+		}
+		q.cond.Wait()
+	}
+}
+
+// Done marks item as done processing, so that its tenant may run another one.
+func (q *FairQueue) Done(item interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.owner[item]
+	if !ok {
+		return
+	}
+	delete(q.owner, item)
+	t.inflight--
+	t.group.inflight--
+	q.gc(t)
+	q.cond.Broadcast()
+}
+
+// Len returns the number of pending items.
+func (q *FairQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+// ShutDown makes Get return immediately and drops new items.
+func (q *FairQueue) ShutDown() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.shuttingDown = true
+	q.cond.Broadcast()
+}
+
+func (q *FairQueue) push(item interface{}) {
+	gt, tt := q.tenantOf(item)
+	g, ok := q.groups[gt.Key]
+	if !ok {
+		g = &group{key: gt.Key, tenants: make(map[string]*tenant)}
+		q.groups[gt.Key] = g
+	}
+	g.weight, g.concurrency = limits(gt)
+	t, ok := g.tenants[tt.Key]
+	if !ok {
+		t = &tenant{key: tt.Key, group: g}
+		g.tenants[tt.Key] = t
+	}
+	t.weight, t.concurrency = limits(tt)
+
+	// an idle group or tenant should not bank credit from the time it was
+	// idle
+	if g.pending == 0 && g.finish < q.vtime {
+		g.finish = q.vtime
+	}
+	if len(t.items) == 0 && t.finish < g.vtime {
+		t.finish = g.vtime
+	}
+	t.items = append(t.items, item)
+	g.pending++
+	q.pending++
+	q.cond.Signal()
+}
+
+// limits returns weight and concurrency of t, at least 1 each
+func limits(t Tenant) (weight, concurrency int) {
+	weight, concurrency = t.Weight, t.Concurrency
+	if weight < 1 {
+		weight = 1
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return weight, concurrency
+}
+
+// next returns the runnable tenant of the runnable group with the smallest
+// virtual finish time
+func (q *FairQueue) next() *tenant {
+	var best *group
+	var bestTenant *tenant
+	for _, g := range q.groups {
+		if g.pending == 0 || g.inflight >= g.concurrency {
+			continue
+		}
+		t := g.next()
+		if t == nil {
+			continue
+		}
+		if best == nil || g.finish < best.finish ||
+			(g.finish == best.finish && g.key < best.key) {
+			best, bestTenant = g, t
+		}
+	}
+	return bestTenant
+}
+
+// next returns the runnable tenant of g with the smallest virtual finish
+// time
+func (g *group) next() *tenant {
+	var best *tenant
+	for _, t := range g.tenants {
+		if len(t.items) == 0 || t.inflight >= t.concurrency {
+			continue
+		}
+		if best == nil || t.finish < best.finish ||
+			(t.finish == best.finish && t.key < best.key) {
+			best = t
+		}
+	}
+	return best
+}
+
+// gc drops idle tenants and groups so the maps don't grow without bound
+func (q *FairQueue) gc(t *tenant) {
+	if len(t.items) > 0 || t.inflight > 0 {
+		return
+	}
+	g := t.group
+	delete(g.tenants, t.key)
+	if len(g.tenants) == 0 {
+		delete(q.groups, g.key)
+	}
+}
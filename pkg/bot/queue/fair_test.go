@@ -0,0 +1,209 @@
+package queue
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// items are "org/repo#n", tenants are configured by org and org/repo
+func newTestQueue(capacity int, tenants map[string]Tenant) *FairQueue {
+	tenantOf := func(item interface{}) (Tenant, Tenant) {
+		repo := strings.SplitN(item.(string), "#", 2)[0]
+		org := strings.SplitN(repo, "/", 2)[0]
+		g, t := tenants[org], tenants[repo]
+		g.Key, t.Key = org, repo
+		if g.Concurrency == 0 {
+			g.Concurrency = 100
+		}
+		return g, t
+	}
+	return NewFairQueue(capacity, tenantOf, workqueue.DefaultControllerRateLimiter())
+}
+
+// drain gets every pending item, marking it done right away unless it's in
+// hold
+func drain(q *FairQueue, hold map[string]bool) []string {
+	var got []string
+	for q.Len() > 0 {
+		item, _ := q.Get()
+		got = append(got, item.(string))
+		if !hold[item.(string)] {
+			q.Done(item)
+		}
+	}
+	return got
+}
+
+func TestFairQueueOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants map[string]Tenant
+		items   []string
+		hold    map[string]bool
+		want    []string
+	}{
+		{
+			name:  "fifo within a repo",
+			items: []string{"o/a#1", "o/a#2", "o/a#3"},
+			want:  []string{"o/a#1", "o/a#2", "o/a#3"},
+		},
+		{
+			name:  "repos take turns",
+			items: []string{"o/a#1", "o/a#2", "o/a#3", "o/b#1", "o/b#2"},
+			want:  []string{"o/a#1", "o/b#1", "o/a#2", "o/b#2", "o/a#3"},
+		},
+		{
+			name:    "repos share by weight",
+			tenants: map[string]Tenant{"o/a": {Weight: 2}},
+			items:   []string{"o/a#1", "o/a#2", "o/a#3", "o/a#4", "o/b#1", "o/b#2"},
+			want:    []string{"o/a#1", "o/b#1", "o/a#2", "o/a#3", "o/b#2", "o/a#4"},
+		},
+		{
+			name:  "orgs take turns before their repos",
+			items: []string{"big/a#1", "big/b#1", "big/c#1", "small/x#1", "small/x#2"},
+			want:  []string{"big/a#1", "small/x#1", "big/b#1", "small/x#2", "big/c#1"},
+		},
+		{
+			name:    "orgs share by weight",
+			tenants: map[string]Tenant{"big": {Weight: 2}},
+			items:   []string{"big/a#1", "big/b#1", "big/a#2", "big/b#2", "small/x#1", "small/x#2"},
+			want:    []string{"big/a#1", "small/x#1", "big/b#1", "big/a#2", "small/x#2", "big/b#2"},
+		},
+		{
+			name:  "repo concurrency cap",
+			items: []string{"o/a#1", "o/a#2", "o/b#1"},
+			hold:  map[string]bool{"o/a#1": true},
+			want:  []string{"o/a#1", "o/b#1"},
+		},
+		{
+			name:    "org concurrency cap",
+			tenants: map[string]Tenant{"big": {Concurrency: 1}},
+			items:   []string{"big/a#1", "big/b#1", "small/x#1", "small/x#2"},
+			hold:    map[string]bool{"big/a#1": true},
+			want:    []string{"big/a#1", "small/x#1", "small/x#2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newTestQueue(100, test.tenants)
+			var items []interface{}
+			for _, item := range test.items {
+				items = append(items, item)
+			}
+			if err := q.Add(items...); err != nil {
+				t.Fatal(err)
+			}
+			// a capped tenant keeps its items pending
+			var got []string
+			for len(got) < len(test.want) {
+				item, _ := q.Get()
+				got = append(got, item.(string))
+				if !test.hold[item.(string)] {
+					q.Done(item)
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			if n := q.Len(); n != len(test.items)-len(test.want) {
+				t.Errorf("%d items pending, want %d", n, len(test.items)-len(test.want))
+			}
+		})
+	}
+}
+
+func TestFairQueueIdleCredit(t *testing.T) {
+	q := newTestQueue(100, nil)
+	q.Add("o/a#1", "o/a#2", "o/a#3")
+	drain(q, nil)
+	// b was idle while a was served, it doesn't get ahead of a for it
+	q.Add("o/a#4", "o/a#5", "o/b#1", "o/b#2")
+	got := drain(q, nil)
+	want := []string{"o/a#4", "o/b#1", "o/a#5", "o/b#2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFairQueueCapacity(t *testing.T) {
+	tests := []struct {
+		name    string
+		pending []interface{}
+		add     []interface{}
+		err     error
+		len     int
+	}{
+		{name: "fits", pending: []interface{}{"o/a#1"}, add: []interface{}{"o/a#2", "o/b#1"}, len: 3},
+		{name: "full", pending: []interface{}{"o/a#1", "o/a#2", "o/a#3"}, add: []interface{}{"o/b#1"}, err: ErrFull, len: 3},
+		{name: "all or none", pending: []interface{}{"o/a#1", "o/a#2"}, add: []interface{}{"o/b#1", "o/b#2"}, err: ErrFull, len: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newTestQueue(3, nil)
+			if err := q.Add(test.pending...); err != nil {
+				t.Fatal(err)
+			}
+			if err := q.Add(test.add...); err != test.err {
+				t.Errorf("got error %v, want %v", err, test.err)
+			}
+			if n := q.Len(); n != test.len {
+				t.Errorf("%d items pending, want %d", n, test.len)
+			}
+		})
+	}
+}
+
+func TestFairQueueAddSome(t *testing.T) {
+	tests := []struct {
+		name    string
+		pending []interface{}
+		add     []interface{}
+		added   int
+		want    []string
+	}{
+		{name: "fits", pending: []interface{}{"o/a#1"}, add: []interface{}{"o/a#2", "o/b#1"}, added: 2,
+			want: []string{"o/a#1", "o/b#1", "o/a#2"}},
+		{name: "first ones", pending: []interface{}{"o/a#1"}, add: []interface{}{"o/b#1", "o/b#2", "o/b#3"}, added: 2,
+			want: []string{"o/a#1", "o/b#1", "o/b#2"}},
+		{name: "full", pending: []interface{}{"o/a#1", "o/a#2", "o/a#3"}, add: []interface{}{"o/b#1"}, added: 0,
+			want: []string{"o/a#1", "o/a#2", "o/a#3"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newTestQueue(3, nil)
+			if err := q.Add(test.pending...); err != nil {
+				t.Fatal(err)
+			}
+			if n := q.AddSome(test.add...); n != test.added {
+				t.Errorf("added %d items, want %d", n, test.added)
+			}
+			if got := drain(q, nil); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFairQueueForgetsIdleTenants(t *testing.T) {
+	q := newTestQueue(100, nil)
+	q.Add("o/a#1", "p/b#1")
+	drain(q, nil)
+	if n := len(q.groups); n != 0 {
+		t.Errorf("%d groups left, want 0", n)
+	}
+}
+
+func TestFairQueueShutDown(t *testing.T) {
+	q := newTestQueue(100, nil)
+	q.Add("o/a#1")
+	q.ShutDown()
+	if _, shutdown := q.Get(); !shutdown {
+		t.Error("Get returned an item after ShutDown")
+	}
+	if err := q.Add("o/a#2"); err != nil {
+		t.Errorf("Add after ShutDown: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/labels"
+)
+
+// errMergeableUnknown is returned while GitHub computes mergeability in the
+// background, the command is retried through the rate limiter of the queue
+var errMergeableUnknown = retryable(errors.New("mergeability is not computed yet"))
+
+// cmdNeedsRebase labels the pullrequest of c needs-rebase while it has
+// conflicts, and comments when the label is added.
+func (b *Bot) cmdNeedsRebase(ctx context.Context, c *command) error {
+	pr, _, err := b.git.PullRequests.Get(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	if pr.GetState() != "open" {
+		return c.ignore("pullrequest is %s", pr.GetState())
+	}
+	if pr.Mergeable == nil {
+		return errMergeableUnknown
+	}
+
+	current, err := b.issueLabels(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	has := false
+	for _, l := range current {
+		if strings.EqualFold(l, labels.NeedsRebase) {
+			has = true
+		}
+	}
+
+	switch {
+	case !pr.GetMergeable() && !has:
+		if err := b.addLabels(ctx, c, labels.NeedsRebase); err != nil {
+			return err
+		}
+		// comment only when the label is added, not on every push
+		msg := fmt.Sprintf("@%s: this PR has conflicts with `%s`, please rebase it.", pr.User.GetLogin(), pr.Base.GetRef())
+		if err := b.comment(ctx, c, msg); err != nil {
+			return err
+		}
+		c.log().Infof("labeled %s", labels.NeedsRebase)
+	case pr.GetMergeable() && has:
+		if err := b.removeLabel(ctx, c, labels.NeedsRebase); err != nil {
+			return err
+		}
+		c.log().Infof("removed %s", labels.NeedsRebase)
+	}
+	return nil
+}
+
+// cmdNeedsRebaseBranch checks every open pullrequest based on the branch
+// pushed by c, one command per pullrequest
+func (b *Bot) cmdNeedsRebaseBranch(ctx context.Context, c *command) error {
+	e, ok := c.event.(*github.PushEvent)
+	if !ok {
+		return c.invalid()
+	}
+	if c.pending != nil {
+		// pullrequests were listed by an earlier attempt
+		return b.fanOut(c, c.pending)
+	}
+	branch := strings.TrimPrefix(e.GetRef(), "refs/heads/")
+
+	var cmds []*command
+	opt := &github.PullRequestListOptions{
+		State:       "open",
+		Base:        branch,
+		ListOptions: github.ListOptions{Page: 1, PerPage: 100},
+	}
+	for opt.Page > 0 {
+		prs, resp, err := b.git.PullRequests.List(ctx, c.owner, c.repo, opt)
+		if err != nil {
+			return err
+		}
+		for _, pr := range prs {
+			cmds = append(cmds, &command{
+				owner:     c.owner,
+				ownerType: c.ownerType,
+				repo:      c.repo,
+				number:    pr.GetNumber(),
+				author:    pr.User.GetLogin(),
+				user:      c.user,
+				cmd:       needsRebase,
+				event:     c.event,
+				eventType: c.eventType,
+				delivery:  c.delivery,
+			})
+		}
+		opt.Page = resp.NextPage
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+	c.log().Infof("queueing %d pullrequest(s) of %s", len(cmds), branch)
+	return b.fanOut(c, cmds)
+}
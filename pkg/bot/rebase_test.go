@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/dastanng/gitbot/pkg/bot/queue"
+)
+
+func TestNeedsRebase(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     string
+		mergeable *bool
+		labels    []string
+		err       error
+		want      []string // audited actions
+	}{
+		{
+			name:      "conflicts",
+			state:     "open",
+			mergeable: github.Bool(false),
+			labels:    []string{"lgtm"},
+			want:      []string{"Issues.AddLabelsToIssue", "Issues.CreateComment"},
+		},
+		{
+			name:      "conflicts labeled already",
+			state:     "open",
+			mergeable: github.Bool(false),
+			labels:    []string{"Needs-Rebase"},
+		},
+		{
+			name:      "rebased",
+			state:     "open",
+			mergeable: github.Bool(true),
+			labels:    []string{"needs-rebase"},
+			want:      []string{"Issues.RemoveLabelForIssue"},
+		},
+		{
+			name:      "mergeable",
+			state:     "open",
+			mergeable: github.Bool(true),
+		},
+		{
+			name:  "not computed yet",
+			state: "open",
+			err:   errMergeableUnknown,
+		},
+		{
+			name:      "closed",
+			state:     "closed",
+			mergeable: github.Bool(false),
+			err:       &skippedError{outcome: "ignored", reason: "pullrequest is closed"},
+		},
+	}
+	for _, test := range tests {
+		var labels []*github.Label
+		for _, l := range test.labels {
+			labels = append(labels, &github.Label{Name: github.String(l)})
+		}
+		b, _, close := newTestBot(t, map[string]interface{}{
+			"GET /repos/o/r/pulls/1": &github.PullRequest{
+				State:     github.String(test.state),
+				Mergeable: test.mergeable,
+				User:      &github.User{Login: github.String("author")},
+				Base:      &github.PullRequestBranch{Ref: github.String("master")},
+			},
+			"GET /repos/o/r/issues/1/labels":                 labels,
+			"POST /repos/o/r/issues/1/labels":                []*github.Label{{Name: github.String("needs-rebase")}},
+			"DELETE /repos/o/r/issues/1/labels/needs-rebase": nil,
+			"POST /repos/o/r/issues/1/comments":              &github.IssueComment{},
+		})
+
+		c := &command{owner: "o", repo: "r", number: 1, cmd: needsRebase}
+		if err := b.cmdNeedsRebase(context.Background(), c); !reflect.DeepEqual(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+		if got := auditActions(t, b); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got actions %v, want %v", test.name, got, test.want)
+		}
+		close()
+	}
+}
+
+func TestNeedsRebaseBranchFanOut(t *testing.T) {
+	var prs []*github.PullRequest
+	for i := 1; i <= 5; i++ {
+		prs = append(prs, &github.PullRequest{Number: github.Int(i), User: &github.User{Login: github.String("author")}})
+	}
+	b, gh, close := newTestBot(t, map[string]interface{}{
+		"GET /repos/o/r/pulls": prs,
+	})
+	defer close()
+	b.queue = queue.NewFairQueue(3, b.tenantOf, workqueue.DefaultControllerRateLimiter())
+
+	c := &command{owner: "o", repo: "r", cmd: needsRebaseBranch, event: &github.PushEvent{Ref: github.String("refs/heads/master")}}
+	b.queue.Add(c)
+	item, _ := b.queue.Get()
+
+	// the queue has room for 3 pullrequests only
+	err := b.cmdNeedsRebaseBranch(context.Background(), c)
+	if !isRetryable(err) || len(c.pending) != 2 {
+		t.Fatalf("got error %v with %d pending, want a retryable error with 2 pending", err, len(c.pending))
+	}
+	b.queue.Done(item)
+	var numbers []int
+	for b.queue.Len() > 0 {
+		item, _ := b.queue.Get()
+		numbers = append(numbers, item.(*command).number)
+		b.queue.Done(item)
+	}
+
+	// a retry queues the rest without listing pullrequests again
+	delete(gh.routes, "GET /repos/o/r/pulls")
+	if err := b.cmdNeedsRebaseBranch(context.Background(), c); err != nil || c.pending != nil {
+		t.Fatalf("retry: got error %v with %d pending, want all queued", err, len(c.pending))
+	}
+	for b.queue.Len() > 0 {
+		item, _ := b.queue.Get()
+		numbers = append(numbers, item.(*command).number)
+		b.queue.Done(item)
+	}
+	if want := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(numbers, want) {
+		t.Errorf("queued pullrequests %v, want %v", numbers, want)
+	}
+}
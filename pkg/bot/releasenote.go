@@ -0,0 +1,315 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/labels"
+)
+
+// releaseNoteNoneRoles may tell by /release-note-none that a pullrequest
+// needs no release note
+var releaseNoteNoneRoles = []string{roleAuthor, roleMember, roleCollaborator}
+
+// releaseNoteBlock matches a ```release-note fenced block of a description
+var releaseNoteBlock = regexp.MustCompile("(?s)```release-note[ \\t]*\\r?\\n(.*?)```")
+
+// releaseNote returns the note in body and whether there's a release-note
+// block at all. A note of NONE means the change needs no release note.
+func releaseNote(body string) (string, bool) {
+	m := releaseNoteBlock.FindStringSubmatch(body)
+	if m == nil {
+		return "", false
+	}
+	return strings.TrimSpace(strings.Replace(m[1], "\r\n", "\n", -1)), true
+}
+
+// isNoneNote returns whether note says the change needs no release note
+func isNoneNote(note string) bool {
+	return strings.EqualFold(note, "none")
+}
+
+// cmdReleaseNote labels the pullrequest of c by the release note of its
+// description: release-note for a note, release-note-none for NONE (or
+// /release-note-none), and do-not-merge/release-note-label-needed if the
+// note is missing.
+func (b *Bot) cmdReleaseNote(ctx context.Context, c *command) error {
+	e, ok := c.event.(*github.PullRequestEvent)
+	if !ok {
+		return c.invalid()
+	}
+	current, err := b.issueLabels(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+
+	note, ok := releaseNote(e.PullRequest.GetBody())
+	want := labels.ReleaseNoteNeeded
+	switch {
+	case ok && len(note) > 0 && !isNoneNote(note):
+		want = labels.ReleaseNote
+	case ok && isNoneNote(note):
+		want = labels.ReleaseNoteNone
+	default:
+		// release-note-none may also be told by /release-note-none, the
+		// label alone doesn't tell whether the description said NONE
+		none, err := b.releaseNoteNoneCommented(ctx, c)
+		if err != nil {
+			return err
+		}
+		if none {
+			want = labels.ReleaseNoteNone
+		}
+	}
+	return b.setReleaseNoteLabel(ctx, c, current, want)
+}
+
+// releaseNoteNoneCommented returns whether a comment on the pullrequest of
+// c has /release-note-none by a user allowed to use it
+func (b *Bot) releaseNoteNoneCommented(ctx context.Context, c *command) (bool, error) {
+	opt := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{Page: 1, PerPage: 100}}
+	for opt.Page > 0 {
+		comments, resp, err := b.git.Issues.ListComments(ctx, c.owner, c.repo, c.number, opt)
+		if err != nil {
+			return false, err
+		}
+		for _, comment := range comments {
+			for _, cmd := range parseCommentBody(comment.GetBody()) {
+				if cmd.cmd != "/release-note-none" || len(cmd.args) != 0 {
+					continue
+				}
+				by := *c
+				by.user = comment.User.GetLogin()
+				allowed, err := b.hasRole(ctx, &by, releaseNoteNoneRoles)
+				if err != nil {
+					return false, err
+				}
+				if allowed {
+					return true, nil
+				}
+			}
+		}
+		opt.Page = resp.NextPage
+	}
+	return false, nil
+}
+
+// cmdReleaseNoteNone handles command /release-note-none, which tells that
+// the pullrequest of c needs no release note
+func (b *Bot) cmdReleaseNoteNone(ctx context.Context, c *command) error {
+	// check command syntax
+	if len(c.args) != 0 {
+		return c.invalid()
+	}
+	if !b.cfg.ReleaseNote.Enabled(c.owner, c.repo) {
+		return c.ignore("release notes are not required")
+	}
+
+	allowed, err := b.hasRole(ctx, c, releaseNoteNoneRoles)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return c.ignore("user is neither author, a member nor a collaborator")
+	}
+
+	pr, resp, err := b.git.PullRequests.Get(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return c.ignore("%d is not a pullrequest", c.number)
+		}
+		return err
+	}
+	if note, _ := releaseNote(pr.GetBody()); len(note) > 0 && !isNoneNote(note) {
+		return b.comment(ctx, c, fmt.Sprintf("@%s: this PR has a release note, remove it from the description (or write `NONE`) instead.", c.user))
+	}
+
+	current, err := b.issueLabels(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	return b.setReleaseNoteLabel(ctx, c, current, labels.ReleaseNoteNone)
+}
+
+// setReleaseNoteLabel makes want the only release note label of the
+// pullrequest of c, current being its labels
+func (b *Bot) setReleaseNoteLabel(ctx context.Context, c *command, current []string, want string) error {
+	for _, l := range []string{labels.ReleaseNote, labels.ReleaseNoteNone, labels.ReleaseNoteNeeded} {
+		if l != want && containsFold(current, l) {
+			if err := b.removeLabel(ctx, c, l); err != nil {
+				return err
+			}
+		}
+	}
+	if containsFold(current, want) {
+		return nil
+	}
+	if err := b.addLabels(ctx, c, want); err != nil {
+		return err
+	}
+	c.log().Infof("labeled %s", want)
+	return nil
+}
+
+// ReleaseNotesOptions selects the pullrequests of release notes
+type ReleaseNotesOptions struct {
+	// Repo is owner/repo
+	Repo string
+	// From and To are tags (or any commit-ish), pullrequests of the commits
+	// reachable from To but not from From are collected
+	From string
+	To   string
+}
+
+// ReleaseNotes writes markdown release notes of the pullrequests merged in
+// a range, grouped by their kind labels. Pullrequests without a release
+// note are listed by title, those needing none are left out.
+func (b *Bot) ReleaseNotes(ctx context.Context, opts ReleaseNotesOptions, out io.Writer) error {
+	parts := strings.SplitN(opts.Repo, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("repo %q should be owner/repo", opts.Repo)
+	}
+	owner, repo := parts[0], parts[1]
+
+	shas, err := b.compareCommits(ctx, owner, repo, opts.From, opts.To)
+	if err != nil {
+		return err
+	}
+	// a pullrequest is found by any of its commits, whether it was merged,
+	// squashed or rebased
+	var prs []*github.PullRequest
+	seen := make(map[int]bool)
+	for _, sha := range shas {
+		list, err := b.commitPullRequests(ctx, owner, repo, sha)
+		if err != nil {
+			return err
+		}
+		for _, pr := range list {
+			if pr.MergedAt == nil || seen[pr.GetNumber()] {
+				continue
+			}
+			seen[pr.GetNumber()] = true
+			prs = append(prs, pr)
+		}
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].GetNumber() < prs[j].GetNumber() })
+
+	_, err = io.WriteString(out, renderReleaseNotes(opts.From, opts.To, prs))
+	return err
+}
+
+// compareCommits returns shas of the commits reachable from head but not
+// from base. The vendored client doesn't page through comparisons.
+func (b *Bot) compareCommits(ctx context.Context, owner, repo, base, head string) ([]string, error) {
+	var shas []string
+	total := 0
+	page := 1
+	for page > 0 {
+		u := fmt.Sprintf("repos/%v/%v/compare/%v...%v?page=%d&per_page=100", owner, repo, base, head, page)
+		req, err := b.git.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		comp := new(github.CommitsComparison)
+		resp, err := b.git.Do(ctx, req, comp)
+		if err != nil {
+			return nil, fmt.Errorf("compare %s...%s: %v", base, head, err)
+		}
+		for _, rc := range comp.Commits {
+			shas = append(shas, rc.GetSHA())
+		}
+		total = comp.GetTotalCommits()
+		page = resp.NextPage
+	}
+	if len(shas) < total {
+		return nil, fmt.Errorf("compare %s...%s lists %d of %d commits, release notes would be incomplete", base, head, len(shas), total)
+	}
+	return shas, nil
+}
+
+// commitPullRequests returns the pullrequests of a commit, which the
+// vendored client lacks
+func (b *Bot) commitPullRequests(ctx context.Context, owner, repo, sha string) ([]*github.PullRequest, error) {
+	var prs []*github.PullRequest
+	page := 1
+	for page > 0 {
+		u := fmt.Sprintf("repos/%v/%v/commits/%v/pulls?page=%d&per_page=100", owner, repo, sha, page)
+		req, err := b.git.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github.groot-preview+json")
+		var list []*github.PullRequest
+		resp, err := b.git.Do(ctx, req, &list)
+		if err != nil {
+			return nil, err
+		}
+		prs = append(prs, list...)
+		page = resp.NextPage
+	}
+	return prs, nil
+}
+
+// renderReleaseNotes groups notes of prs by kind, e.g. kind/bug under
+// "Bug", pullrequests without a kind come last
+func renderReleaseNotes(from, to string, prs []*github.PullRequest) string {
+	const other = "Other"
+	groups := make(map[string][]string)
+	for _, pr := range prs {
+		var names []string
+		for _, l := range pr.Labels {
+			names = append(names, l.GetName())
+		}
+		note, ok := releaseNote(pr.GetBody())
+		if containsFold(names, labels.ReleaseNoteNone) || (ok && isNoneNote(note)) {
+			continue
+		}
+		if len(note) == 0 {
+			note = pr.GetTitle()
+		}
+
+		kind := other
+		sort.Strings(names)
+		for _, l := range names {
+			if strings.HasPrefix(strings.ToLower(l), "kind/") {
+				kind = strings.Title(l[len("kind/"):])
+				break
+			}
+		}
+		// continuation lines of a note belong to its list item
+		note = strings.Replace(note, "\n", "\n  ", -1)
+		groups[kind] = append(groups[kind], fmt.Sprintf("- %s (#%d, @%s)", note, pr.GetNumber(), pr.User.GetLogin()))
+	}
+
+	var kinds []string
+	for k := range groups {
+		if k != other {
+			kinds = append(kinds, k)
+		}
+	}
+	sort.Strings(kinds)
+	if len(groups[other]) > 0 {
+		kinds = append(kinds, other)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Release notes for %s\n\nChanges since %s.\n", to, from)
+	if len(kinds) == 0 {
+		fmt.Fprintf(&buf, "\nNo notable changes.\n")
+	}
+	for _, k := range kinds {
+		fmt.Fprintf(&buf, "\n## %s\n\n", k)
+		for _, line := range groups[k] {
+			fmt.Fprintln(&buf, line)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestReleaseNote(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		note string
+		ok   bool
+	}{
+		{name: "no block", body: "Fixes #12"},
+		{name: "note", body: "Fixes #12\n\n```release-note\nFixed a crash of /retest.\n```\n", note: "Fixed a crash of /retest.", ok: true},
+		{name: "multi-line note", body: "```release-note\nAdded /milestone.\nIt needs a maintainers team.\n```", note: "Added /milestone.\nIt needs a maintainers team.", ok: true},
+		{name: "crlf", body: "```release-note\r\nFixed x.\r\nAnd y.\r\n```", note: "Fixed x.\nAnd y.", ok: true},
+		{name: "none", body: "```release-note\nNONE\n```", note: "NONE", ok: true},
+		{name: "empty block", body: "```release-note\n```", note: "", ok: true},
+		{name: "other fence", body: "```go\nfmt.Println()\n```"},
+		{name: "first block", body: "```release-note\nfirst\n```\n```release-note\nsecond\n```", note: "first", ok: true},
+	}
+	for _, test := range tests {
+		note, ok := releaseNote(test.body)
+		if note != test.note || ok != test.ok {
+			t.Errorf("%s: releaseNote() = %q, %v, want %q, %v", test.name, note, ok, test.note, test.ok)
+		}
+	}
+}
+
+func TestIsNoneNote(t *testing.T) {
+	for note, want := range map[string]bool{
+		"NONE":          true,
+		"none":          true,
+		"None":          true,
+		"":              false,
+		"NONE of these": false,
+	} {
+		if got := isNoneNote(note); got != want {
+			t.Errorf("isNoneNote(%q) = %v, want %v", note, got, want)
+		}
+	}
+}
+
+func TestRenderReleaseNotes(t *testing.T) {
+	pr := func(number int, title, body string, labels ...string) *github.PullRequest {
+		p := &github.PullRequest{
+			Number: github.Int(number),
+			Title:  github.String(title),
+			Body:   github.String(body),
+			User:   &github.User{Login: github.String("dev")},
+		}
+		for _, l := range labels {
+			p.Labels = append(p.Labels, &github.Label{Name: github.String(l)})
+		}
+		return p
+	}
+	tests := []struct {
+		name string
+		prs  []*github.PullRequest
+		want string
+	}{
+		{
+			name: "no changes",
+			prs: []*github.PullRequest{
+				pr(1, "Refactor", "```release-note\nNONE\n```"),
+				pr(2, "Fix typo", "", "release-note-none"),
+			},
+			want: "# Release notes for v1.1.0\n\nChanges since v1.0.0.\n\nNo notable changes.\n",
+		},
+		{
+			name: "grouped by kind",
+			prs: []*github.PullRequest{
+				pr(3, "Add /milestone", "```release-note\nAdded /milestone.\nIt needs a maintainers team.\n```", "kind/feature"),
+				pr(4, "Fix crash", "```release-note\nFixed a crash.\n```", "kind/bug", "area/retest"),
+				pr(5, "Bump deps", ""),
+			},
+			want: "# Release notes for v1.1.0\n\nChanges since v1.0.0.\n" +
+				"\n## Bug\n\n- Fixed a crash. (#4, @dev)\n" +
+				"\n## Feature\n\n- Added /milestone.\n  It needs a maintainers team. (#3, @dev)\n" +
+				"\n## Other\n\n- Bump deps (#5, @dev)\n",
+		},
+	}
+	for _, test := range tests {
+		if got := renderReleaseNotes("v1.0.0", "v1.1.0", test.prs); got != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// failed conclusions of check runs, and failed states of statuses
+var (
+	failedConclusions = []string{"failure", "timed_out", "cancelled"}
+	failedStates      = []string{"failure", "error"}
+)
+
+// cmdTest reruns CI of the pullrequest of c: /retest reruns failed jobs,
+// /test <context> reruns a job by name, /test all reruns every job.
+// Check runs are re-requested on GitHub, status contexts are rerun by the
+// configured http triggers. Jobs which are queued or running already are
+// left alone, so that a retried command doesn't restart what it triggered.
+func (b *Bot) cmdTest(ctx context.Context, c *command) error {
+	var name string
+	switch c.cmd {
+	case "/retest":
+		if len(c.args) != 0 {
+			return c.invalid()
+		}
+	case "/test":
+		if len(c.args) != 1 {
+			return c.invalid()
+		}
+		name = c.args[0]
+	}
+	all := strings.EqualFold(name, "all")
+
+	// validates if user is a 'member' or 'collaborator' of owner/repo
+	isMember, err := b.isMember(ctx, c.owner, c.repo, c.user)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return c.ignore("user %s is not a member or collaborator", c.user)
+	}
+
+	pr, resp, err := b.git.PullRequests.Get(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return c.ignore("%d is not a pullrequest", c.number)
+		}
+		return err
+	}
+	sha := pr.Head.GetSHA()
+
+	runs, err := b.checkRuns(ctx, c.owner, c.repo, sha)
+	if err != nil {
+		return err
+	}
+	statuses, err := b.statuses(ctx, c.owner, c.repo, sha)
+	if err != nil {
+		return err
+	}
+
+	busy := make(map[int64]bool) // suites having a run which isn't completed
+	for _, run := range runs {
+		if run.GetStatus() != "completed" {
+			busy[run.GetCheckSuite().GetID()] = true
+		}
+	}
+
+	var jobs, skipped, running []string
+	// suites rerun as a whole, false if only GitHub Apps may do so
+	suites := make(map[int64]bool)
+	for _, run := range runs {
+		id := run.GetCheckSuite().GetID()
+		switch {
+		case all && busy[id], !all && run.GetStatus() != "completed" && (len(name) == 0 || strings.EqualFold(run.GetName(), name)):
+			running = append(running, run.GetName())
+			continue
+		case all:
+			// rerun whole suites, so that jobs depending on others run again
+			if _, ok := suites[id]; !ok {
+				err := b.rerequestCheckSuite(ctx, c, id)
+				if err != nil && !isForbidden(err) {
+					return err
+				}
+				// only GitHub Apps may rerun suites, with a token the runs
+				// of the suite are rerun one by one instead
+				suites[id] = err == nil
+			}
+			if !suites[id] {
+				if err := b.rerequestCheckRun(ctx, c, run.GetID(), run.GetName()); err != nil {
+					return err
+				}
+			}
+		case len(name) == 0 && containsFold(failedConclusions, run.GetConclusion()),
+			strings.EqualFold(run.GetName(), name):
+			if err := b.rerequestCheckRun(ctx, c, run.GetID(), run.GetName()); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+		jobs = append(jobs, run.GetName())
+	}
+
+	contexts := make(map[string]bool)
+	for _, s := range statuses {
+		contexts[strings.ToLower(s.GetContext())] = true
+		if !all && !strings.EqualFold(s.GetContext(), name) &&
+			!(len(name) == 0 && containsFold(failedStates, s.GetState())) {
+			continue
+		}
+		if s.GetState() == "pending" {
+			running = append(running, s.GetContext())
+			continue
+		}
+		ok, err := b.triggerCI(ctx, c, sha, s.GetContext())
+		if err != nil {
+			return err
+		}
+		if ok {
+			jobs = append(jobs, s.GetContext())
+		} else {
+			skipped = append(skipped, s.GetContext())
+		}
+	}
+	// a context which has never reported can still be triggered by name
+	if len(name) > 0 && !all && !contexts[strings.ToLower(name)] && len(jobs) == 0 && len(running) == 0 {
+		t := b.cfg.CI.TriggerFor(c.owner, c.repo, name)
+		if t != nil && containsFold(t.Contexts, name) {
+			if _, err := b.triggerCI(ctx, c, sha, name); err != nil {
+				return err
+			}
+			jobs = append(jobs, name)
+		}
+	}
+
+	if err := b.comment(ctx, c, testReply(c, jobs, skipped, running)); err != nil {
+		return err
+	}
+	c.log().Infof("retriggered %d job(s), skipped %d, %d running", len(jobs), len(skipped), len(running))
+	return nil
+}
+
+// testReply tells which jobs were retriggered
+func testReply(c *command, jobs, skipped, running []string) string {
+	var buf bytes.Buffer
+	switch {
+	case len(jobs) == 0 && len(running) > 0:
+		fmt.Fprintf(&buf, "@%s: nothing retriggered by `%s`.\n", c.user, c.line())
+	case len(jobs) == 0:
+		fmt.Fprintf(&buf, "@%s: no job to rerun for `%s`.\n", c.user, c.line())
+	default:
+		fmt.Fprintf(&buf, "@%s: retriggered by `%s`:\n\n", c.user, c.line())
+		for _, j := range jobs {
+			fmt.Fprintf(&buf, "- %s\n", j)
+		}
+	}
+	if len(running) > 0 {
+		fmt.Fprintf(&buf, "\nAlready queued or running: %s.\n", strings.Join(running, ", "))
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(&buf, "\nNo trigger is configured for %s.\n", strings.Join(skipped, ", "))
+	}
+	return buf.String()
+}
+
+// checkRuns returns the latest check runs of ref
+func (b *Bot) checkRuns(ctx context.Context, owner, repo, ref string) ([]*github.CheckRun, error) {
+	var runs []*github.CheckRun
+	opt := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{Page: 1, PerPage: 100}}
+	for opt.Page > 0 {
+		result, resp, err := b.git.Checks.ListCheckRunsForRef(ctx, owner, repo, ref, opt)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, result.CheckRuns...)
+		opt.Page = resp.NextPage
+	}
+	return runs, nil
+}
+
+// statuses returns the latest status of every context of ref
+func (b *Bot) statuses(ctx context.Context, owner, repo, ref string) ([]github.RepoStatus, error) {
+	var statuses []github.RepoStatus
+	opt := &github.ListOptions{Page: 1, PerPage: 100}
+	for opt.Page > 0 {
+		combined, resp, err := b.git.Repositories.GetCombinedStatus(ctx, owner, repo, ref, opt)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, combined.Statuses...)
+		opt.Page = resp.NextPage
+	}
+	return statuses, nil
+}
+
+// triggerCI reruns a status context by its http trigger. It returns false if
+// no trigger is configured for the context.
+func (b *Bot) triggerCI(ctx context.Context, c *command, sha, statusContext string) (bool, error) {
+	t := b.cfg.CI.TriggerFor(c.owner, c.repo, statusContext)
+	if t == nil {
+		return false, nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"owner":   c.owner,
+		"repo":    c.repo,
+		"number":  c.number,
+		"sha":     sha,
+		"context": statusContext,
+		"user":    c.user,
+	})
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(t.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("trigger %s of %s: %s", t.URL, statusContext, resp.Status)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return false, permanent(err)
+		}
+		return false, retryable(err)
+	}
+	b.record(c.auditRecord("CI.Trigger", nil, []string{statusContext}))
+	return true, nil
+}
+
+// containsFold returns whether list contains s, case-insensitively
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
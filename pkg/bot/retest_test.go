@@ -0,0 +1,163 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/audit"
+	"github.com/dastanng/gitbot/pkg/bot/config"
+)
+
+func TestTest(t *testing.T) {
+	run := func(id, suite int64, name, status, conclusion string) map[string]interface{} {
+		return map[string]interface{}{
+			"id": id, "name": name, "status": status, "conclusion": conclusion,
+			"check_suite": map[string]int64{"id": suite},
+		}
+	}
+	checkRuns := map[string]interface{}{
+		"total_count": 5,
+		"check_runs": []interface{}{
+			run(1, 10, "unit", "completed", "failure"),
+			run(2, 10, "lint", "completed", "success"),
+			run(3, 20, "e2e", "in_progress", ""),
+			run(4, 20, "build", "completed", "success"),
+			run(5, 30, "docs", "completed", "success"),
+		},
+	}
+	status := map[string]interface{}{
+		"statuses": []map[string]string{
+			{"context": "ci/jenkins", "state": "failure"},
+			{"context": "ci/other", "state": "error"},
+			{"context": "ci/slow", "state": "pending"},
+		},
+	}
+
+	// the http trigger of ci/jenkins
+	var triggered []string
+	ci := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		triggered = append(triggered, fmt.Sprint(body["context"]))
+	}))
+	defer ci.Close()
+
+	tests := []struct {
+		name    string
+		cmd     string
+		args    []string
+		suites  int      // status of rerunning a suite
+		want    []string // audited actions and what they changed
+		comment string   // part of the comment
+	}{
+		{
+			name: "retest",
+			cmd:  "/retest",
+			want: []string{"Checks.ReRequestCheckRun [unit]", "CI.Trigger [ci/jenkins]", "Issues.CreateComment []"},
+			// ci/other has no trigger
+			comment: "Already queued or running: e2e.\n\nNo trigger is configured for ci/other.",
+		},
+		{
+			name:    "name",
+			cmd:     "/test",
+			args:    []string{"Lint"},
+			want:    []string{"Checks.ReRequestCheckRun [lint]", "Issues.CreateComment []"},
+			comment: "retriggered by `/test Lint`:\n\n- lint\n",
+		},
+		{
+			name:    "running",
+			cmd:     "/test",
+			args:    []string{"e2e"},
+			want:    []string{"Issues.CreateComment []"},
+			comment: "nothing retriggered by `/test e2e`.\n\nAlready queued or running: e2e.",
+		},
+		{
+			name:    "unknown",
+			cmd:     "/test",
+			args:    []string{"fuzz"},
+			want:    []string{"Issues.CreateComment []"},
+			comment: "no job to rerun for `/test fuzz`.",
+		},
+		{
+			name:    "all",
+			cmd:     "/test",
+			args:    []string{"all"},
+			suites:  http.StatusCreated,
+			want:    []string{"Checks.ReRequestCheckSuite [10]", "Checks.ReRequestCheckSuite [30]", "CI.Trigger [ci/jenkins]", "Issues.CreateComment []"},
+			comment: "Already queued or running: e2e, build, ci/slow.",
+		},
+		{
+			name:   "all by token",
+			cmd:    "/test",
+			args:   []string{"all"},
+			suites: http.StatusForbidden,
+			want: []string{"Checks.ReRequestCheckRun [unit]", "Checks.ReRequestCheckRun [lint]", "Checks.ReRequestCheckRun [docs]",
+				"CI.Trigger [ci/jenkins]", "Issues.CreateComment []"},
+			comment: "Already queued or running: e2e, build, ci/slow.",
+		},
+	}
+	for _, test := range tests {
+		var comment string
+		triggered = nil
+		routes := map[string]interface{}{
+			"GET /orgs/o/members/alice":              nil,
+			"GET /repos/o/r/pulls/1":                 &github.PullRequest{Head: &github.PullRequestBranch{SHA: github.String("s")}},
+			"GET /repos/o/r/commits/s/check-runs":    checkRuns,
+			"GET /repos/o/r/commits/s/status":        status,
+			"POST /repos/o/r/check-runs/1/rerequest": nil,
+			"POST /repos/o/r/check-runs/2/rerequest": nil,
+			"POST /repos/o/r/check-runs/5/rerequest": nil,
+			"POST /repos/o/r/issues/1/comments": func(r *http.Request) (int, interface{}) {
+				var c github.IssueComment
+				json.NewDecoder(r.Body).Decode(&c)
+				comment = c.GetBody()
+				return http.StatusCreated, &c
+			},
+		}
+		for _, id := range []int{10, 20, 30} {
+			routes[fmt.Sprintf("POST /repos/o/r/check-suites/%d/rerequest", id)] = func(r *http.Request) (int, interface{}) {
+				if test.suites == http.StatusForbidden {
+					return test.suites, map[string]string{"message": "Resource not accessible by integration"}
+				}
+				return test.suites, nil
+			}
+		}
+		b, gh, close := newTestBot(t, routes)
+		b.cfg.CI.Triggers = []config.CITrigger{{Repos: []string{"o"}, Contexts: []string{"ci/jenkins"}, URL: ci.URL}}
+
+		c := &command{owner: "o", repo: "r", number: 1, user: "alice", cmd: test.cmd, args: test.args}
+		if err := b.cmdTest(context.Background(), c); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		records, err := b.audit.Query(audit.Query{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range records {
+			got = append(got, fmt.Sprintf("%s %v", r.Action, r.After))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+		if !strings.Contains(comment, test.comment) {
+			t.Errorf("%s: got comment %q, want it to contain %q", test.name, comment, test.comment)
+		}
+		// runs in progress are left alone
+		if gh.called("POST /repos/o/r/check-runs/3/rerequest") || gh.called("POST /repos/o/r/check-suites/20/rerequest") {
+			t.Errorf("%s: reran e2e, which is in progress", test.name)
+		}
+		if containsFold(triggered, "ci/other") || containsFold(triggered, "ci/slow") {
+			t.Errorf("%s: triggered %v", test.name, triggered)
+		}
+		close()
+	}
+}
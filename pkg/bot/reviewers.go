@@ -0,0 +1,209 @@
+package bot
+
+import (
+	"context"
+	"math/rand"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/yaml.v2"
+
+	"github.com/dastanng/gitbot/pkg/bot/glob"
+)
+
+// owners is the part of an OWNERS file used to pick reviewers
+type owners struct {
+	Reviewers []string `yaml:"reviewers"`
+	Approvers []string `yaml:"approvers"`
+}
+
+// cmdReviewers requests reviews on the pullrequest of c from candidates of
+// its changed files, weighted by the lines they change. The author and
+// users on vacation are never requested.
+func (b *Bot) cmdReviewers(ctx context.Context, c *command) error {
+	e, ok := c.event.(*github.PullRequestEvent)
+	if !ok {
+		return c.invalid()
+	}
+	rule := b.cfg.Reviewers.RuleFor(c.owner, c.repo)
+	if rule == nil {
+		return c.ignore("no reviewers configured")
+	}
+	count := b.cfg.Reviewers.Count - len(e.PullRequest.RequestedReviewers)
+	if count <= 0 {
+		return c.ignore("reviewers already requested")
+	}
+
+	files, err := b.prFiles(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	var ownersOf func(string) []string
+	if rule.OwnersFiles {
+		var paths []string
+		for _, f := range files {
+			paths = append(paths, f.GetFilename())
+		}
+		if ownersOf, err = b.ownersFiles(ctx, c.owner, c.repo, e.PullRequest.Base.GetSHA(), paths); err != nil {
+			return err
+		}
+	}
+
+	skip := map[string]bool{strings.ToLower(c.author): true}
+	for _, u := range b.cfg.Reviewers.Vacation {
+		skip[strings.ToLower(u)] = true
+	}
+	for _, u := range e.PullRequest.RequestedReviewers {
+		skip[strings.ToLower(u.GetLogin())] = true
+	}
+	weights := reviewerWeights(files, rule.Paths, ownersOf, skip)
+
+	var reviewers []string
+	for len(reviewers) < count && len(weights) > 0 {
+		u := pickWeighted(weights)
+		delete(weights, u)
+		// validates if user is a 'member' or 'collaborator' of owner/repo
+		isMember, err := b.isMember(ctx, c.owner, c.repo, u)
+		if err != nil {
+			return err
+		}
+		if isMember {
+			reviewers = append(reviewers, u)
+		}
+	}
+	if len(reviewers) == 0 {
+		return c.ignore("no reviewer candidate")
+	}
+
+	if err := b.requestReviewers(ctx, c, reviewers); err != nil {
+		return err
+	}
+	c.log().Infof("requested reviews from %s", strings.Join(reviewers, ", "))
+	return nil
+}
+
+// reviewerWeights weighs the candidates of files by the lines they change.
+// Candidates are users of the globs of paths matching a file, and of
+// ownersOf the file if it's not nil. Users in skip are left out.
+func reviewerWeights(files []*github.CommitFile, paths map[string][]string, ownersOf func(string) []string, skip map[string]bool) map[string]int {
+	weights := make(map[string]int)
+	for _, f := range files {
+		var candidates []string
+		for pattern, users := range paths {
+			if glob.Match(pattern, f.GetFilename()) {
+				candidates = append(candidates, users...)
+			}
+		}
+		if ownersOf != nil {
+			candidates = append(candidates, ownersOf(f.GetFilename())...)
+		}
+		for _, u := range candidates {
+			u = strings.ToLower(u)
+			if !skip[u] {
+				// every file counts, even if it only changes its mode
+				weights[u] += f.GetAdditions() + f.GetDeletions() + 1
+			}
+		}
+	}
+	return weights
+}
+
+// pickWeighted picks a user at random, proportionally to its weight
+func pickWeighted(weights map[string]int) string {
+	users := make([]string, 0, len(weights))
+	total := 0
+	for u, w := range weights {
+		users = append(users, u)
+		total += w
+	}
+	// map order is random, sort to pick by rand only
+	sort.Strings(users)
+	n := rand.Intn(total)
+	for _, u := range users {
+		if n -= weights[u]; n < 0 {
+			return u
+		}
+	}
+	return users[len(users)-1]
+}
+
+// ownersFiles reads the OWNERS files of the repo at sha in the directories
+// above files. The tree of sha is listed once, so only existing OWNERS files
+// are fetched. It returns the reviewers of the closest OWNERS file above a
+// file, falling back to approvers if the file lists no reviewers.
+func (b *Bot) ownersFiles(ctx context.Context, owner, repo, sha string, files []string) (func(string) []string, error) {
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		for dir := path.Dir(f); !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+			if dir == "." || dir == "/" {
+				break
+			}
+		}
+	}
+	tree, _, err := b.git.Git.GetTree(ctx, owner, repo, sha, true)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewers := make(map[string][]string)
+	add := func(p string, content []byte) {
+		var o owners
+		if err := yaml.Unmarshal(content, &o); err != nil {
+			log.with("owner", owner).with("repo", repo).Warningf("invalid OWNERS file %s: %v", p, err)
+			return
+		}
+		users := o.Reviewers
+		if len(users) == 0 {
+			users = o.Approvers
+		}
+		if len(users) > 0 {
+			reviewers[path.Dir(p)] = users
+		}
+	}
+
+	if tree.GetTruncated() {
+		// the tree is too large to be listed at once, look for an OWNERS
+		// file in every directory
+		for dir := range dirs {
+			p := path.Join(dir, "OWNERS")
+			content, err := b.repoFile(ctx, owner, repo, p, sha)
+			if err != nil {
+				return nil, err
+			}
+			if len(content) > 0 {
+				add(p, []byte(content))
+			}
+		}
+		return closestOwners(reviewers), nil
+	}
+	for _, e := range tree.Entries {
+		p := e.GetPath()
+		if e.GetType() != "blob" || path.Base(p) != "OWNERS" || !dirs[path.Dir(p)] {
+			continue
+		}
+		content, _, err := b.git.Git.GetBlobRaw(ctx, owner, repo, e.GetSHA())
+		if err != nil {
+			return nil, err
+		}
+		add(p, content)
+	}
+	return closestOwners(reviewers), nil
+}
+
+// closestOwners returns the reviewers of the closest directory above a file
+// in reviewers, which maps directories to the reviewers of their OWNERS file
+func closestOwners(reviewers map[string][]string) func(string) []string {
+	return func(file string) []string {
+		for dir := path.Dir(file); ; dir = path.Dir(dir) {
+			if users, ok := reviewers[dir]; ok {
+				return users
+			}
+			if dir == "." || dir == "/" {
+				return nil
+			}
+		}
+	}
+}
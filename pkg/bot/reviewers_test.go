@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestPickWeighted(t *testing.T) {
+	rand.Seed(1)
+	if got := pickWeighted(map[string]int{"alice": 5}); got != "alice" {
+		t.Errorf("single user: got %s, want alice", got)
+	}
+
+	picks := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		picks[pickWeighted(map[string]int{"alice": 3, "bob": 1})]++
+	}
+	if len(picks) != 2 || picks["alice"] < 2700 || picks["alice"] > 3300 {
+		t.Errorf("weights 3:1: got %v, want alice about 3000 times", picks)
+	}
+}
+
+func TestClosestOwners(t *testing.T) {
+	ownersOf := closestOwners(map[string][]string{
+		".":       {"root"},
+		"pkg":     {"pkg"},
+		"pkg/bot": {"bot"},
+	})
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{"README.md", []string{"root"}},
+		{"docs/config.md", []string{"root"}},
+		{"pkg/util.go", []string{"pkg"}},
+		{"pkg/bot/bot.go", []string{"bot"}},
+		{"pkg/bot/queue/fair.go", []string{"bot"}},
+		{"pkg/botany/leaf.go", []string{"pkg"}},
+	}
+	for _, test := range tests {
+		if got := ownersOf(test.file); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ownersOf(%s) = %v, want %v", test.file, got, test.want)
+		}
+	}
+
+	if got := closestOwners(map[string][]string{"pkg": {"pkg"}})("README.md"); got != nil {
+		t.Errorf("no OWNERS above: got %v, want none", got)
+	}
+}
+
+func TestReviewerWeights(t *testing.T) {
+	files := []*github.CommitFile{
+		{Filename: github.String("docs/config.md"), Additions: github.Int(10), Deletions: github.Int(2)},
+		{Filename: github.String("pkg/bot/bot.go"), Additions: github.Int(3)},
+		{Filename: github.String("pkg/bot/run.sh")}, // mode change
+	}
+	paths := map[string][]string{
+		"docs/**":   {"Alice", "author"},
+		"pkg/**":    {"bob", "away"},
+		"*.sh":      {"carol", "requested"},
+		"vendor/**": {"dave"},
+	}
+	ownersOf := func(file string) []string {
+		if file == "pkg/bot/bot.go" {
+			return []string{"alice", "erin"}
+		}
+		return nil
+	}
+	skip := map[string]bool{"author": true, "away": true, "requested": true}
+
+	tests := []struct {
+		name     string
+		ownersOf func(string) []string
+		want     map[string]int
+	}{
+		{
+			name: "paths",
+			want: map[string]int{"alice": 13, "bob": 5, "carol": 1},
+		},
+		{
+			name:     "paths and owners",
+			ownersOf: ownersOf,
+			want:     map[string]int{"alice": 17, "bob": 5, "carol": 1, "erin": 4},
+		},
+	}
+	for _, test := range tests {
+		if got := reviewerWeights(files, paths, test.ownersOf, skip); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOwnersFiles(t *testing.T) {
+	entry := func(path, typ, sha string) map[string]string {
+		return map[string]string{"path": path, "type": typ, "sha": sha}
+	}
+	b, gh, close := newTestBot(t, map[string]interface{}{
+		"GET /repos/o/r/git/trees/base": map[string]interface{}{
+			"sha": "base",
+			"tree": []interface{}{
+				entry("OWNERS", "blob", "root"),
+				entry("pkg", "tree", "pkgtree"),
+				entry("pkg/OWNERS", "blob", "pkg"),
+				entry("pkg/bot/OWNERS", "blob", "bot"),
+				entry("pkg/other/OWNERS", "blob", "other"),
+				entry("docs/OWNERS", "blob", "docs"),
+				entry("docs/OWNERS.md", "blob", "readme"),
+			},
+		},
+		"GET /repos/o/r/git/blobs/root":  []byte("reviewers: [root]\n"),
+		"GET /repos/o/r/git/blobs/pkg":   []byte("reviewers: []\napprovers: [pkg-approver]\n"),
+		"GET /repos/o/r/git/blobs/bot":   []byte("approvers: [x]\nreviewers: [bot]\n"),
+		"GET /repos/o/r/git/blobs/docs":  []byte("reviewers: [unclosed\n"),
+		"GET /repos/o/r/git/blobs/other": []byte("reviewers: [other]\n"),
+	})
+	defer close()
+
+	ownersOf, err := b.ownersFiles(context.Background(), "o", "r", "base",
+		[]string{"pkg/bot/bot.go", "pkg/util.go", "docs/config.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{"pkg/bot/bot.go", []string{"bot"}},
+		{"pkg/util.go", []string{"pkg-approver"}},
+		// invalid OWNERS files are skipped
+		{"docs/config.md", []string{"root"}},
+	}
+	for _, test := range tests {
+		if got := ownersOf(test.file); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ownersOf(%s) = %v, want %v", test.file, got, test.want)
+		}
+	}
+	for _, route := range []string{"GET /repos/o/r/git/blobs/other", "GET /repos/o/r/git/blobs/readme"} {
+		if gh.called(route) {
+			t.Errorf("%s: OWNERS file above no changed file is fetched", route)
+		}
+	}
+}
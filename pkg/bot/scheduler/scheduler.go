@@ -0,0 +1,160 @@
+// Package scheduler runs periodic jobs, one run of a job at a time.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+var (
+	// ErrRunning is returned when a job is triggered while it's running
+	ErrRunning = errors.New("job is running")
+	// ErrUnknown is returned when triggering a job which is not registered
+	ErrUnknown = errors.New("unknown job")
+)
+
+// Job is a named function run periodically or on demand
+type Job struct {
+	Name string
+	// Interval between the end of a run and the start of the next one,
+	// zero runs the job only when it's triggered
+	Interval time.Duration
+	// Jitter delays a run by up to Jitter*Interval at random
+	Jitter float64
+	// Timeout bounds a run, Interval is used if zero
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// Status is the state of a job and its last run
+type Status struct {
+	Name      string    `json:"name"`
+	Interval  string    `json:"interval"`
+	Running   bool      `json:"running"`
+	Runs      int       `json:"runs"`
+	LastStart time.Time `json:"last_start,omitempty"`
+	LastEnd   time.Time `json:"last_end,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+type entry struct {
+	job    Job
+	status Status
+}
+
+// Scheduler runs registered jobs
+type Scheduler struct {
+	ctx  context.Context
+	mu   sync.Mutex
+	jobs map[string]*entry
+	// done is called after every run
+	done func(name string, err error, d time.Duration)
+}
+
+// New returns a scheduler, runs are canceled with ctx. done (if not nil) is
+// called after every run.
+func New(ctx context.Context, done func(name string, err error, d time.Duration)) *Scheduler {
+	return &Scheduler{ctx: ctx, jobs: make(map[string]*entry), done: done}
+}
+
+// Register adds a job, names must be unique
+func (s *Scheduler) Register(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+	s.jobs[job.Name] = &entry{job: job, status: Status{Name: job.Name, Interval: job.Interval.String()}}
+	return nil
+}
+
+// Start runs every job with an interval until stopCh is closed,
+// the first run starts right away. The interval is measured from the end
+// of a run, so that a run longer than the interval doesn't make the next
+// one start right after it.
+func (s *Scheduler) Start(stopCh <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.jobs {
+		if e.job.Interval <= 0 {
+			continue
+		}
+		name := e.job.Name
+		go wait.JitterUntil(func() {
+			// a manual run may be in progress, skip this round then
+			s.Trigger(name, true)
+		}, e.job.Interval, e.job.Jitter, true, stopCh)
+	}
+}
+
+// Trigger runs a job, in the background unless block is set. It fails with
+// ErrRunning instead of overlapping a running run.
+func (s *Scheduler) Trigger(name string, block bool) error {
+	s.mu.Lock()
+	e, ok := s.jobs[name]
+	if !ok {
+		s.mu.Unlock()
+		return ErrUnknown
+	}
+	if e.status.Running {
+		s.mu.Unlock()
+		return ErrRunning
+	}
+	e.status.Running = true
+	e.status.LastStart = time.Now()
+	s.mu.Unlock()
+
+	if !block {
+		go s.run(e)
+		return nil
+	}
+	return s.run(e)
+}
+
+func (s *Scheduler) run(e *entry) error {
+	timeout := e.job.Timeout
+	if timeout <= 0 {
+		timeout = e.job.Interval
+	}
+	ctx, cancel := s.ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(s.ctx, timeout)
+	}
+	defer cancel()
+
+	err := e.job.Run(ctx)
+
+	s.mu.Lock()
+	e.status.Running = false
+	e.status.Runs++
+	e.status.LastEnd = time.Now()
+	e.status.LastError = ""
+	if err != nil {
+		e.status.LastError = err.Error()
+	}
+	d := e.status.LastEnd.Sub(e.status.LastStart)
+	s.mu.Unlock()
+
+	if s.done != nil {
+		s.done(e.job.Name, err, d)
+	}
+	return err
+}
+
+// Status returns the status of every job, sorted by name
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Status, 0, len(s.jobs))
+	for _, e := range s.jobs {
+		list = append(list, e.status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
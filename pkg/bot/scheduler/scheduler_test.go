@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTrigger(t *testing.T) {
+	done := make(chan error, 1)
+	s := New(context.Background(), func(name string, err error, d time.Duration) { done <- err })
+
+	release := make(chan struct{})
+	fail := errors.New("failed")
+	if err := s.Register(Job{Name: "job", Run: func(ctx context.Context) error {
+		<-release
+		return fail
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(Job{Name: "job"}); err == nil {
+		t.Error("registered a job twice")
+	}
+
+	if err := s.Trigger("other", false); err != ErrUnknown {
+		t.Errorf("unknown job: got %v, want ErrUnknown", err)
+	}
+	if err := s.Trigger("job", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Trigger("job", true); err != ErrRunning {
+		t.Errorf("running job: got %v, want ErrRunning", err)
+	}
+	if st := s.Status()[0]; !st.Running || st.Runs != 0 {
+		t.Errorf("running job: got status %+v", st)
+	}
+
+	close(release)
+	if err := <-done; err != fail {
+		t.Errorf("got error %v, want %v", err, fail)
+	}
+	st := s.Status()[0]
+	if st.Running || st.Runs != 1 || st.LastError != "failed" || st.LastEnd.Before(st.LastStart) {
+		t.Errorf("done job: got status %+v", st)
+	}
+
+	// done, the job may run again
+	if err := s.Trigger("job", true); err != fail {
+		t.Errorf("rerun: got error %v, want %v", err, fail)
+	}
+	<-done
+}
+
+func TestStart(t *testing.T) {
+	const (
+		interval = 30 * time.Millisecond
+		run      = 2 * interval
+	)
+	s := New(context.Background(), nil)
+
+	var (
+		mu         sync.Mutex
+		starts     []time.Time
+		ends       []time.Time
+		manualRuns int
+	)
+	finished := make(chan struct{})
+	s.Register(Job{Name: "manual", Run: func(ctx context.Context) error {
+		manualRuns++
+		return nil
+	}})
+	s.Register(Job{Name: "periodic", Interval: interval, Jitter: 0, Run: func(ctx context.Context) error {
+		mu.Lock()
+		starts = append(starts, time.Now())
+		mu.Unlock()
+		time.Sleep(run)
+		mu.Lock()
+		defer mu.Unlock()
+		ends = append(ends, time.Now())
+		if len(ends) == 3 {
+			close(finished)
+		}
+		return nil
+	}})
+
+	stopCh := make(chan struct{})
+	s.Start(stopCh)
+	<-finished
+	close(stopCh)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// the interval is measured from the end of a run, without jitter
+	for i := 1; i < 3; i++ {
+		if gap := starts[i].Sub(ends[i-1]); gap < interval || gap > interval+interval/2 {
+			t.Errorf("run %d started %v after the previous one ended, want %v", i, gap, interval)
+		}
+	}
+	if manualRuns != 0 {
+		t.Errorf("job without interval ran %d times, want only when triggered", manualRuns)
+	}
+}
@@ -0,0 +1,48 @@
+package bot
+
+import (
+	"sync"
+	"time"
+)
+
+// seenCache remembers keys for a while, e.g. commands already run from a
+// comment, so that redelivered or edited comments don't run them twice.
+type seenCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]time.Time
+	swept   time.Time
+}
+
+func newSeenCache(ttl time.Duration) *seenCache {
+	return &seenCache{
+		ttl:     ttl,
+		entries: make(map[string]time.Time),
+		swept:   time.Now(),
+	}
+}
+
+// has returns whether key was seen within ttl
+func (s *seenCache) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.entries[key]
+	return ok && time.Since(t) <= s.ttl
+}
+
+// add records key, dropping expired keys from time to time
+func (s *seenCache) add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.swept) > s.ttl {
+		for k, t := range s.entries {
+			if now.Sub(t) > s.ttl {
+				delete(s.entries, k)
+			}
+		}
+		s.swept = now
+	}
+	s.entries[key] = now
+}
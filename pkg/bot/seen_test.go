@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeenCache(t *testing.T) {
+	s := newSeenCache(time.Hour)
+	if s.has("a") {
+		t.Error("a: seen before added")
+	}
+	s.add("a")
+	s.add("b")
+	if !s.has("a") || !s.has("b") {
+		t.Error("a, b: not seen after added")
+	}
+
+	// a expires, b is seen again
+	s.entries["a"] = time.Now().Add(-2 * time.Hour)
+	s.entries["b"] = time.Now().Add(-2 * time.Hour)
+	s.add("b")
+	if s.has("a") {
+		t.Error("a: seen after ttl")
+	}
+	if !s.has("b") {
+		t.Error("b: not seen after added again")
+	}
+
+	// expired keys are dropped once ttl passed since the last sweep
+	s.swept = time.Now().Add(-2 * time.Hour)
+	s.add("c")
+	if _, ok := s.entries["a"]; ok {
+		t.Error("a: kept after sweep")
+	}
+	if len(s.entries) != 2 {
+		t.Errorf("got %d entries after sweep, want 2", len(s.entries))
+	}
+}
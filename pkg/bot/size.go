@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"bufio"
+	"context"
+	"strings"
+
+	"github.com/google/go-github/github"
+
+	"github.com/dastanng/gitbot/pkg/bot/glob"
+)
+
+// size labels, from the smallest
+var sizeLabels = []string{"size/XS", "size/S", "size/M", "size/L", "size/XL", "size/XXL"}
+
+// cmdSize labels the pullrequest of c by its number of changed lines,
+// a previous size label is replaced.
+func (b *Bot) cmdSize(ctx context.Context, c *command) error {
+	e, ok := c.event.(*github.PullRequestEvent)
+	if !ok {
+		return c.invalid()
+	}
+
+	files, err := b.prFiles(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	attrs, err := b.repoFile(ctx, c.owner, c.repo, ".gitattributes", e.PullRequest.Head.GetSHA())
+	if err != nil {
+		return err
+	}
+	ignored := parseLinguistIgnored(attrs)
+
+	var lines int
+	for _, f := range files {
+		name := f.GetFilename()
+		if isVendored(name) || ignored(name) || glob.Any(b.cfg.Size.Ignore, name) {
+			continue
+		}
+		lines += f.GetAdditions() + f.GetDeletions()
+	}
+	size := b.sizeLabel(lines)
+	log := c.log().with("lines", lines)
+
+	current, err := b.issueLabels(ctx, c.owner, c.repo, c.number)
+	if err != nil {
+		return err
+	}
+	has := false
+	for _, l := range current {
+		switch {
+		case l == size:
+			has = true
+		case isSizeLabel(l):
+			if err := b.removeLabel(ctx, c, l); err != nil {
+				return err
+			}
+		}
+	}
+	if has {
+		log.Infof("already labeled %s", size)
+		return nil
+	}
+	if err := b.addLabels(ctx, c, size); err != nil {
+		return err
+	}
+	log.Infof("labeled %s", size)
+	return nil
+}
+
+// sizeLabel returns the size label of a pullrequest changing lines
+func (b *Bot) sizeLabel(lines int) string {
+	t := b.cfg.Size.Thresholds
+	for i, min := range []int{t.XXL, t.XL, t.L, t.M, t.S} {
+		if lines >= min {
+			return sizeLabels[len(sizeLabels)-1-i]
+		}
+	}
+	return sizeLabels[0]
+}
+
+func isSizeLabel(name string) bool {
+	for _, l := range sizeLabels {
+		if strings.EqualFold(l, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isVendored returns whether name is under a vendor/ directory
+func isVendored(name string) bool {
+	return strings.HasPrefix(name, "vendor/") || strings.Contains(name, "/vendor/")
+}
+
+// parseLinguistIgnored parses .gitattributes, it returns whether a file is
+// marked linguist-generated or linguist-vendored. Later lines take
+// precedence, as in git.
+func parseLinguistIgnored(gitattributes string) func(name string) bool {
+	type rule struct {
+		pattern string
+		ignored bool
+	}
+	var rules []rule
+	s := bufio.NewScanner(strings.NewReader(gitattributes))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for _, attr := range fields[1:] {
+			switch attr {
+			case "linguist-generated", "linguist-generated=true", "linguist-vendored", "linguist-vendored=true":
+				rules = append(rules, rule{fields[0], true})
+			case "-linguist-generated", "linguist-generated=false", "-linguist-vendored", "linguist-vendored=false":
+				rules = append(rules, rule{fields[0], false})
+			}
+		}
+	}
+
+	return func(name string) bool {
+		for i := len(rules) - 1; i >= 0; i-- {
+			if glob.Match(rules[i].pattern, name) {
+				return rules[i].ignored
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/dastanng/gitbot/pkg/bot/config"
+)
+
+func TestSizeLabel(t *testing.T) {
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Bot{cfg: cfg}
+	// default thresholds are 10, 30, 100, 500 and 1000 lines
+	tests := []struct {
+		lines int
+		want  string
+	}{
+		{0, "size/XS"},
+		{9, "size/XS"},
+		{10, "size/S"},
+		{29, "size/S"},
+		{30, "size/M"},
+		{100, "size/L"},
+		{499, "size/L"},
+		{500, "size/XL"},
+		{1000, "size/XXL"},
+		{100000, "size/XXL"},
+	}
+	for _, test := range tests {
+		if got := b.sizeLabel(test.lines); got != test.want {
+			t.Errorf("sizeLabel(%d) = %s, want %s", test.lines, got, test.want)
+		}
+	}
+}
+
+func TestIsVendored(t *testing.T) {
+	for name, want := range map[string]bool{
+		"vendor/github.com/google/go-github/github/github.go": true,
+		"web/vendor/jquery.js":                                true,
+		"vendored.go":                                         false,
+		"pkg/vendorlist/list.go":                              false,
+	} {
+		if got := isVendored(name); got != want {
+			t.Errorf("isVendored(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestParseLinguistIgnored(t *testing.T) {
+	ignored := parseLinguistIgnored(`
+# generated code
+*.pb.go linguist-generated
+api/ linguist-generated=true
+api/handwritten.go -linguist-generated
+third_party/** linguist-vendored
+*.md text eol=lf
+`)
+	for name, want := range map[string]bool{
+		"pkg/api/types.pb.go":        true,
+		"api/client.go":              true,
+		"api/handwritten.go":         false,
+		"third_party/lib/lib.go":     true,
+		"README.md":                  false,
+		"pkg/bot/bot.go":             false,
+		"pkg/third_party/helpers.go": false,
+	} {
+		if got := ignored(name); got != want {
+			t.Errorf("ignored(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -2,37 +2,89 @@ package bot
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
 
-	"github.com/golang/glog"
-
-	"github.com/dastanng/gitbot/pkg/bot/labels"
+	"github.com/google/go-github/github"
 )
 
-func (b *Bot) addPresetLabels(owner, repo string) error {
-
-	recognizedLabels, err := b.getRepoLabels(owner, repo)
-	if err != nil {
-		glog.Errorf("getRepoLabels err: %v", err)
-		return err
-	}
+// addPresetLabels creates preset labels missing in the repo of c
+func (b *Bot) addPresetLabels(ctx context.Context, c *command) error {
+	owner, repo := c.owner, c.repo
+	log := c.log()
 
-	labels, err := labels.LoadPresets()
+	recognizedLabels, err := b.getRepoLabels(ctx, owner, repo)
 	if err != nil {
-		glog.Errorf("LoadPresets err: %v", err)
+		log.Errorf("getRepoLabels err: %v", err)
 		return err
 	}
 
-	for _, l := range labels {
+	for _, l := range b.presets.For(owner, repo) {
 		// create preset label if label does not exist
-		if _, ok := recognizedLabels[*l.Name]; !ok {
-			_, _, err := b.git.Issues.CreateLabel(context.Background(), owner, repo, l)
+		if _, ok := recognizedLabels[strings.ToLower(l.Name)]; !ok {
+			err := b.createLabel(ctx, c, &github.Label{
+				Name:        github.String(l.Name),
+				Color:       github.String(strings.TrimPrefix(l.Color, "#")),
+				Description: github.String(l.Description),
+			})
 			if err != nil {
-				glog.Errorf("git.Issues.CreateLabel err: %v", err)
+				log.Errorf("git.Issues.CreateLabel err: %v", err)
 				return err
 			}
 		}
 	}
 
-	glog.Infof("add preset labels to %s/%s succeed!", owner, repo)
+	log.Info("add preset labels succeed!")
 	return nil
 }
+
+// addOrgPresetLabels queues a command adding preset labels for every repo
+// of org on behalf of user, as the installation webhook does. Repos are
+// queued one by one, so that a full queue rejects only the remaining ones.
+// It returns the result of each repo, nil if it's queued.
+func (b *Bot) addOrgPresetLabels(ctx context.Context, org, user string) (map[string]error, error) {
+	repos, err := b.orgRepos(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]error, len(repos))
+	for _, repo := range repos {
+		c := &command{owner: org, repo: repo, user: user, cmd: presetLabels}
+		if results[repo] = b.queue.Add(c); results[repo] == nil {
+			c.log().with("outcome", "queued").Info("command queued")
+		}
+	}
+	return results, nil
+}
+
+// prFiles returns files changed by a pullrequest
+func (b *Bot) prFiles(ctx context.Context, owner, repo string, number int) ([]*github.CommitFile, error) {
+	var files []*github.CommitFile
+	opt := &github.ListOptions{Page: 1, PerPage: 100}
+	for opt.Page > 0 {
+		list, resp, err := b.git.PullRequests.ListFiles(ctx, owner, repo, number, opt)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, list...)
+		opt.Page = resp.NextPage
+	}
+	return files, nil
+}
+
+// repoFile returns the content of path at ref, or "" if it doesn't exist
+func (b *Bot) repoFile(ctx context.Context, owner, repo, path, ref string) (string, error) {
+	file, _, resp, err := b.git.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	if file == nil {
+		return "", fmt.Errorf("%s is not a file", path)
+	}
+	return file.GetContent()
+}
@@ -1,11 +1,13 @@
 package bot
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync/atomic"
+	"time"
 
-	"github.com/golang/glog"
 	"github.com/google/go-github/github"
 )
 
@@ -27,48 +29,25 @@ func (b *Bot) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	b.serve(w, r)
 }
 
-// handleAddPresetLabels adds preset labels to owner's repo
-func (b *Bot) handleAddPresetLabels(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		owner := r.URL.Query().Get("owner")
-		if len(owner) < 1 {
-			http.Error(w, "Url Param 'owner' is missing", http.StatusBadRequest)
-			return
-		}
-		repo := r.URL.Query().Get("repo")
-		if len(repo) < 1 {
-			http.Error(w, "Url Param 'repo' is missing", http.StatusBadRequest)
-			return
-		}
-		if err := b.addPresetLabels(owner, repo); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		return
-	}
-
-	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-	return
-}
-
 // serve validates and dispatches webhook events to corresponding plugins.
 func (b *Bot) serve(w http.ResponseWriter, r *http.Request) {
+	log := log.with("delivery", github.DeliveryID(r)).with("event", github.WebHookType(r))
 	payload, err := github.ValidatePayload(r, []byte(b.secret))
 	if err != nil {
-		glog.Infof("validate payload failed: %v", err)
+		log.Infof("validate payload failed: %v", err)
 		w.WriteHeader(http.StatusForbidden)
 		return
 	}
 	event, err := github.ParseWebHook(github.WebHookType(r), payload)
 	if err != nil {
-		glog.Infof("parse webhook failed: %v", err)
+		log.Infof("parse webhook failed: %v", err)
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte("invalid payload data"))
 		return
 	}
 	switch e := event.(type) {
 	case *github.IssueCommentEvent:
-		if *e.Action != "created" {
+		if *e.Action != "created" && *e.Action != "edited" {
 			return
 		}
 		var (
@@ -76,8 +55,8 @@ func (b *Bot) serve(w http.ResponseWriter, r *http.Request) {
 			repo   = *e.Repo.Name
 			number = *e.Issue.Number
 			author = *e.Issue.User.Login
-			user   = *e.Comment.User.Login
-			cmds   = parseCommentBody(*e.Comment.Body)
+			user   = commentUser(*e.Action, e.Comment.User, e.Sender)
+			cmds   = b.commentCommands("issue_comment", *e.Action, *e.Comment.ID, *e.Comment.Body, e.Changes)
 		)
 		for _, c := range cmds {
 			c.owner = owner
@@ -87,11 +66,11 @@ func (b *Bot) serve(w http.ResponseWriter, r *http.Request) {
 			c.author = author
 			c.user = user
 			c.event = e
-			// add command to working queue
-			b.queue.Add(c)
+			c.url = e.Comment.GetHTMLURL()
 		}
+		b.enqueue(w, r, cmds)
 	case *github.PullRequestReviewCommentEvent:
-		if *e.Action != "created" {
+		if *e.Action != "created" && *e.Action != "edited" {
 			return
 		}
 		var (
@@ -99,8 +78,8 @@ func (b *Bot) serve(w http.ResponseWriter, r *http.Request) {
 			repo   = *e.Repo.Name
 			number = *e.PullRequest.Number
 			author = *e.PullRequest.User.Login
-			user   = *e.Comment.User.Login
-			cmds   = parseCommentBody(*e.Comment.Body)
+			user   = commentUser(*e.Action, e.Comment.User, e.Sender)
+			cmds   = b.commentCommands("pull_request_review_comment", *e.Action, *e.Comment.ID, *e.Comment.Body, e.Changes)
 		)
 		for _, c := range cmds {
 			c.owner = owner
@@ -110,9 +89,97 @@ func (b *Bot) serve(w http.ResponseWriter, r *http.Request) {
 			c.author = author
 			c.user = user
 			c.event = e
-			// add command to working queue
-			b.queue.Add(c)
+			c.url = e.Comment.GetHTMLURL()
+		}
+		b.enqueue(w, r, cmds)
+	case *github.IssuesEvent:
+		if !b.isDescriptionAction(*e.Action) {
+			return
+		}
+		var (
+			owner  = *e.Repo.Owner.Login
+			repo   = *e.Repo.Name
+			number = *e.Issue.Number
+			author = *e.Issue.User.Login
+			user   = commentUser(*e.Action, e.Issue.User, e.Sender)
+			cmds   = b.commentCommands("issues", *e.Action, *e.Issue.ID, e.Issue.GetBody(), e.Changes)
+		)
+		for _, c := range cmds {
+			c.owner = owner
+			c.ownerType = *e.Repo.Owner.Type
+			c.repo = repo
+			c.number = number
+			c.author = author
+			c.user = user
+			c.event = e
+			c.url = e.Issue.GetHTMLURL()
+		}
+		b.enqueue(w, r, cmds)
+	case *github.PullRequestEvent:
+		var (
+			owner  = *e.Repo.Owner.Login
+			repo   = *e.Repo.Name
+			number = *e.PullRequest.Number
+			author = *e.PullRequest.User.Login
+			cmds   = b.pullRequestPlugins(owner, repo, *e.Action)
+		)
+		if *e.Action == "closed" && e.PullRequest.GetMerged() {
+			cmds = append(cmds, &command{cmd: cherryPickMerged})
+		}
+		for _, c := range cmds {
+			c.user = e.Sender.GetLogin()
+		}
+		if b.isDescriptionAction(*e.Action) {
+			user := commentUser(*e.Action, e.PullRequest.User, e.Sender)
+			for _, c := range b.commentCommands("pull_request", *e.Action, *e.PullRequest.ID, e.PullRequest.GetBody(), e.Changes) {
+				c.user = user
+				cmds = append(cmds, c)
+			}
+		}
+		for _, c := range cmds {
+			c.owner = owner
+			c.ownerType = *e.Repo.Owner.Type
+			c.repo = repo
+			c.number = number
+			c.author = author
+			c.event = e
+			c.url = e.PullRequest.GetHTMLURL()
+		}
+		b.enqueue(w, r, cmds)
+	case *github.RepositoryEvent:
+		if *e.Action != "created" {
+			return
 		}
+		b.enqueue(w, r, []*command{repoCommand(presetLabels, e.Repo.GetFullName(), e.Sender)})
+	case *github.InstallationEvent:
+		if *e.Action != "created" {
+			return
+		}
+		var cmds []*command
+		for _, repo := range e.Repositories {
+			cmds = append(cmds, repoCommand(presetLabels, repo.GetFullName(), e.Sender))
+		}
+		b.enqueue(w, r, cmds)
+	case *github.InstallationRepositoriesEvent:
+		if *e.Action != "added" {
+			return
+		}
+		var cmds []*command
+		for _, repo := range e.RepositoriesAdded {
+			cmds = append(cmds, repoCommand(presetLabels, repo.GetFullName(), e.Sender))
+		}
+		b.enqueue(w, r, cmds)
+	case *github.PushEvent:
+		// pullrequests based on a pushed branch may have conflicts now
+		if !strings.HasPrefix(e.GetRef(), "refs/heads/") || e.GetDeleted() {
+			return
+		}
+		c := repoCommand(needsRebaseBranch, e.Repo.GetFullName(), e.Sender)
+		if !b.cfg.NeedsRebase.Enabled(c.owner, c.repo) {
+			return
+		}
+		c.event = e
+		b.enqueue(w, r, []*command{c})
 	case *github.PullRequestReviewEvent:
 		if *e.Action != "submitted" {
 			return
@@ -133,33 +200,151 @@ func (b *Bot) serve(w http.ResponseWriter, r *http.Request) {
 			c.author = author
 			c.user = user
 			c.event = e
-			// add command to working queue
-			b.queue.Add(c)
+			c.url = e.Review.GetHTMLURL()
 		}
+		b.enqueue(w, r, cmds)
 	default:
 	}
 
 }
 
-func parseCommentBody(comment string) []*command {
-	if !strings.HasPrefix(comment, "/") {
-		return nil
+// repoCommand returns a repo-wide plugin command, fullName is owner/repo
+func repoCommand(cmd, fullName string, sender *github.User) *command {
+	c := &command{cmd: cmd, user: sender.GetLogin()}
+	if parts := strings.SplitN(fullName, "/", 2); len(parts) == 2 {
+		c.owner, c.repo = parts[0], parts[1]
 	}
+	return c
+}
 
+// pullRequestPlugins returns plugin commands enabled on owner/repo
+// for action of a pullrequest
+func (b *Bot) pullRequestPlugins(owner, repo, action string) []*command {
 	var cmds []*command
-	for _, line := range strings.Split(comment, "\n") {
-		line = strings.TrimSpace(line)
-		if len(line) == 0 {
-			continue
+	if action == "opened" && b.cfg.Reviewers.RuleFor(owner, repo) != nil {
+		cmds = append(cmds, &command{cmd: autoReviewers})
+	}
+	switch action {
+	case "opened", "reopened", "synchronize":
+		if b.cfg.Size.Enabled(owner, repo) {
+			cmds = append(cmds, &command{cmd: sizeLabel})
 		}
-		if !strings.HasPrefix(line, "/") {
-			return nil
+		if len(b.cfg.AreaLabelsFor(owner, repo)) > 0 {
+			cmds = append(cmds, &command{cmd: areaLabels})
+		}
+		if b.cfg.NeedsRebase.Enabled(owner, repo) {
+			cmds = append(cmds, &command{cmd: needsRebase})
+		}
+		if b.cfg.DCO.Enabled(owner, repo) {
+			cmds = append(cmds, &command{cmd: dcoCheck})
+		}
+	}
+	switch action {
+	case "opened", "reopened", "edited":
+		if b.cfg.ReleaseNote.Enabled(owner, repo) {
+			cmds = append(cmds, &command{cmd: releaseNoteLabel})
+		}
+	}
+	switch action {
+	case "opened", "reopened", "synchronize", "edited":
+		// edits may change the title
+		if b.cfg.Policy.RuleFor(owner, repo) != nil {
+			cmds = append(cmds, &command{cmd: policyCheck})
 		}
-		cmdargs := strings.Split(line, " ")
-		cmds = append(cmds, &command{
-			cmd:  cmdargs[0],
-			args: cmdargs[1:],
-		})
 	}
 	return cmds
 }
+
+// isDescriptionAction returns whether commands in the description of an
+// issue (or pullrequest) should be run for action. Commands are run when it
+// is opened, and optionally when its description is edited.
+func (b *Bot) isDescriptionAction(action string) bool {
+	return action == "opened" || (action == "edited" && b.cfg.Command.DescriptionEdits)
+}
+
+// commentCommands returns commands to run from a created (or opened) or edited
+// comment, where the description of an issue counts as a comment.
+// For an edited comment only commands newly added to the body are returned.
+// Either way a command already run from the same comment, or repeated in
+// it, is not run again.
+func (b *Bot) commentCommands(kind, action string, id int64, body string, changes *github.EditChange) []*command {
+	var cmds []*command
+	switch action {
+	case "created", "opened":
+		cmds = parseCommentBody(body)
+	case "edited":
+		// e.g. only the title of an issue is edited
+		if changes == nil || changes.Body == nil || changes.Body.From == nil {
+			return nil
+		}
+		cmds = addedCommands(parseCommentBody(*changes.Body.From), parseCommentBody(body))
+	}
+
+	var fresh []*command
+	keys := make(map[string]bool)
+	for _, c := range cmds {
+		// keys are only added to seen once queued, repeated lines of this
+		// comment are dropped here
+		c.key = fmt.Sprintf("%s/%d:%s", kind, id, c.raw)
+		if !keys[c.key] && !b.seen.has(c.key) {
+			fresh = append(fresh, c)
+		}
+		keys[c.key] = true
+	}
+	return fresh
+}
+
+// addedCommands returns commands in cur which are not in prev.
+// A command repeated n times in prev cancels out n of its occurrences in cur.
+func addedCommands(prev, cur []*command) []*command {
+	count := make(map[string]int)
+	for _, c := range prev {
+		count[c.raw]++
+	}
+	var added []*command
+	for _, c := range cur {
+		if count[c.raw] > 0 {
+			count[c.raw]--
+			continue
+		}
+		added = append(added, c)
+	}
+	return added
+}
+
+// commentUser returns the user a comment command is attributed to.
+// Commands added by editing a comment belong to whoever edited it.
+func commentUser(action string, author, sender *github.User) string {
+	if action == "edited" && sender != nil {
+		return sender.GetLogin()
+	}
+	return author.GetLogin()
+}
+
+// enqueue adds commands of webhook request r to working queue.
+// When the queue is full, GitHub is asked to retry later.
+func (b *Bot) enqueue(w http.ResponseWriter, r *http.Request, cmds []*command) {
+	if len(cmds) == 0 {
+		return
+	}
+	items := make([]interface{}, 0, len(cmds))
+	for _, c := range cmds {
+		c.delivery = github.DeliveryID(r)
+		c.eventType = github.WebHookType(r)
+		items = append(items, c)
+	}
+	if err := b.queue.Add(items...); err != nil {
+		cmds[0].log().with("outcome", "rejected").Warningf("%v, rejecting %d command(s)", err, len(cmds))
+		retryAfter := int(b.cfg.Queue.RetryAfter / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("too many pending commands"))
+		return
+	}
+	for _, c := range cmds {
+		if len(c.key) > 0 {
+			b.seen.add(c.key)
+		}
+		c.log().with("outcome", "queued").Info("command queued")
+	}
+}
@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func lines(cmds []*command) []string {
+	var got []string
+	for _, c := range cmds {
+		got = append(got, c.raw)
+	}
+	return got
+}
+
+func TestAddedCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		prev string
+		cur  string
+		want []string
+	}{
+		{name: "none", prev: "/lgtm", cur: "/lgtm\nthanks"},
+		{name: "added", prev: "/lgtm", cur: "/lgtm\n/hold", want: []string{"/hold"}},
+		{name: "removed", prev: "/lgtm\n/hold", cur: "/lgtm"},
+		{name: "args changed", prev: "/kind bug", cur: "/kind feature", want: []string{"/kind feature"}},
+		{name: "moved", prev: "/hold\n/lgtm", cur: "/lgtm\n/hold"},
+		{name: "repeated", prev: "/lgtm", cur: "/lgtm\n/lgtm", want: []string{"/lgtm"}},
+		{name: "quoting changed", prev: `/retitle "a b"`, cur: "/retitle a b", want: []string{"/retitle a b"}},
+	}
+	for _, test := range tests {
+		got := addedCommands(parseCommentBody(test.prev), parseCommentBody(test.cur))
+		if !reflect.DeepEqual(lines(got), test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, lines(got), test.want)
+		}
+	}
+}
+
+func TestCommentCommands(t *testing.T) {
+	b := &Bot{seen: newSeenCache(time.Hour)}
+	edit := func(from string) *github.EditChange {
+		return &github.EditChange{Body: &struct {
+			From *string `json:"from,omitempty"`
+		}{From: github.String(from)}}
+	}
+
+	// repeated lines of a comment run once
+	got := b.commentCommands("comment", "created", 1, "/lgtm\n/kind bug\n/lgtm", nil)
+	if want := []string{"/lgtm", "/kind bug"}; !reflect.DeepEqual(lines(got), want) {
+		t.Fatalf("created: got %q, want %q", lines(got), want)
+	}
+	for _, c := range got {
+		b.seen.add(c.key)
+	}
+
+	tests := []struct {
+		name    string
+		kind    string
+		id      int64
+		action  string
+		body    string
+		changes *github.EditChange
+		want    []string
+	}{
+		{name: "redelivered", kind: "comment", id: 1, action: "created", body: "/lgtm\n/kind bug"},
+		{name: "other comment", kind: "comment", id: 2, action: "created", body: "/lgtm", want: []string{"/lgtm"}},
+		{name: "description", kind: "issue", id: 1, action: "opened", body: "/lgtm", want: []string{"/lgtm"}},
+		{name: "title edited", kind: "comment", id: 1, action: "edited", body: "/lgtm\n/hold"},
+		{name: "edited", kind: "comment", id: 1, action: "edited", body: "/lgtm\n/hold", changes: edit("/lgtm"), want: []string{"/hold"}},
+		// removed, then added back
+		{name: "run already", kind: "comment", id: 1, action: "edited", body: "/kind bug", changes: edit("")},
+	}
+	for _, test := range tests {
+		got := b.commentCommands(test.kind, test.action, test.id, test.body, test.changes)
+		if !reflect.DeepEqual(lines(got), test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, lines(got), test.want)
+		}
+	}
+}